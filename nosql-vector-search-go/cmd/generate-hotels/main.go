@@ -0,0 +1,153 @@
+// Package main generates synthetic hotel documents for loading the vector
+// search sample at scale. Each hotel gets a plausible name, category, tags,
+// rating, and location, and a deterministic pseudo-embedding (a unit vector
+// from a seeded PRNG), so large containers can be loaded without any Azure
+// OpenAI calls.
+//
+// Output is newline-delimited JSON, written one hotel at a time so memory use
+// stays flat however many hotels are generated:
+//
+//	go run ./cmd/generate-hotels -n 100000 -out ../data/hotels_100k.jsonl
+//
+// Point DATA_FILE_WITH_VECTORS at the file to load it. The vectors are random,
+// so search results are only meaningful as a measure of index behavior and
+// cost, not relevance.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/data"
+)
+
+var (
+	nameFirst  = []string{"Grand", "Royal", "Harbor", "Mountain", "City", "Lakeside", "Sunset", "Pine", "Riverside", "Historic", "Coastal", "Maple"}
+	nameSecond = []string{"View", "Crest", "Gardens", "Park", "Plaza", "Lodge", "Point", "Bay", "Ridge", "Square", "Springs", "Meadows"}
+	nameSuffix = []string{"Hotel", "Inn", "Suites", "Resort", "Lodge", "Motel"}
+	categories = []string{"Boutique", "Budget", "Luxury", "Resort and Spa", "Extended-Stay", "Suite"}
+	tags       = []string{"pool", "view", "air conditioning", "concierge", "free wifi", "restaurant", "bar", "laundry service", "24-hour front desk", "continental breakfast", "free parking", "pet friendly"}
+	features   = []string{"walking distance to shops and restaurants", "a rooftop terrace", "easy access to the airport", "quiet rooms away from the street", "an on-site spa", "hiking trails nearby", "a fitness center", "a short drive to the beach"}
+	cities     = []struct {
+		city, state string
+		lon, lat    float64
+	}{
+		{"New York", "NY", -73.98, 40.75},
+		{"Seattle", "WA", -122.33, 47.61},
+		{"Atlanta", "GA", -84.39, 33.75},
+		{"Denver", "CO", -104.99, 39.74},
+		{"Chicago", "IL", -87.63, 41.88},
+		{"San Diego", "CA", -117.16, 32.72},
+	}
+)
+
+func main() {
+	defaultDims := 1536
+	if v := os.Getenv("EMBEDDING_DIMENSIONS"); v != "" {
+		if d, err := strconv.Atoi(v); err == nil {
+			defaultDims = d
+		}
+	}
+
+	count := flag.Int("n", 10000, "number of hotels to generate")
+	dims := flag.Int("dims", defaultDims, "vector dimensions; defaults to EMBEDDING_DIMENSIONS")
+	seed := flag.Uint64("seed", 1, "PRNG seed; the same seed produces the same hotels")
+	out := flag.String("out", "", "output file (default stdout)")
+	flag.Parse()
+
+	if *count < 1 {
+		log.Fatalf("-n must be at least 1, got %d", *count)
+	}
+	if *dims < 1 {
+		log.Fatalf("-dims must be at least 1, got %d", *dims)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	rng := rand.New(rand.NewPCG(*seed, 0))
+	for i := range *count {
+		if err := enc.Encode(generateHotel(rng, i+1, *dims)); err != nil {
+			log.Fatalf("Failed to write hotel %d: %v", i+1, err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Generated %d hotels with %d-dimension vectors\n", *count, *dims)
+}
+
+// generateHotel builds one synthetic hotel from the PRNG.
+func generateHotel(rng *rand.Rand, id, dims int) data.Hotel {
+	city := cities[rng.IntN(len(cities))]
+	name := fmt.Sprintf("%s %s %s", pick(rng, nameFirst), pick(rng, nameSecond), pick(rng, nameSuffix))
+	category := pick(rng, categories)
+
+	hotelTags := make([]string, 0, 3)
+	for _, i := range rng.Perm(len(tags))[:1+rng.IntN(3)] {
+		hotelTags = append(hotelTags, tags[i])
+	}
+
+	return data.Hotel{
+		HotelID:   "synthetic-" + strconv.Itoa(id),
+		HotelName: name,
+		Description: fmt.Sprintf("%s in %s offers %s and %s.",
+			name, city.city, pick(rng, features), pick(rng, features)),
+		Category:        category,
+		Tags:            hotelTags,
+		ParkingIncluded: rng.IntN(2) == 0,
+		LastRenovation:  time.Date(2000+rng.IntN(25), time.Month(1+rng.IntN(12)), 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		Rating:          math.Round((1+rng.Float64()*4)*10) / 10,
+		Address: map[string]interface{}{
+			"StreetAddress": fmt.Sprintf("%d Main St", 1+rng.IntN(9999)),
+			"City":          city.city,
+			"StateProvince": city.state,
+			"Country":       "USA",
+		},
+		Location: map[string]interface{}{
+			"type":        "Point",
+			"coordinates": []float64{city.lon + rng.Float64()*0.2 - 0.1, city.lat + rng.Float64()*0.2 - 0.1},
+		},
+		DescriptionVector: unitVector(rng, dims),
+	}
+}
+
+// unitVector returns a random vector of length dims with magnitude 1, drawn
+// from a normal distribution so its direction is uniform.
+func unitVector(rng *rand.Rand, dims int) []float32 {
+	v := make([]float64, dims)
+	var norm float64
+	for i := range v {
+		v[i] = rng.NormFloat64()
+		norm += v[i] * v[i]
+	}
+	norm = math.Sqrt(norm)
+
+	out := make([]float32, dims)
+	for i := range v {
+		out[i] = float32(v[i] / norm)
+	}
+	return out
+}
+
+func pick(rng *rand.Rand, options []string) string {
+	return options[rng.IntN(len(options))]
+}
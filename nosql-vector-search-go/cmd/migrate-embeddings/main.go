@@ -0,0 +1,152 @@
+// Package main re-embeds the hotels in a container with a new embedding
+// model, for example after moving from text-embedding-ada-002 to
+// text-embedding-3-small. The new vectors are written to a separate vector
+// field, so searches keep using the current field while the migration runs:
+//
+//	go run ./cmd/migrate-embeddings -target-model text-embedding-3-small -target-field DescriptionVector3 -deployment text-embedding-3-small
+//
+// The container needs a vector embedding policy and vector index for the
+// target field, with the new model's dimensions. The command is safe to rerun
+// after an interruption; documents already migrated are skipped. Once every
+// document has been migrated it records the new field as the active
+// embedding in the container (see data.SetActiveEmbedding), which switches
+// searches and loads over to it.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/client"
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/config"
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/data"
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
+)
+
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	targetModel := flag.String("target-model", "", "embedding model to migrate to, such as text-embedding-3-small (required)")
+	targetVersion := flag.String("target-version", "", "version of the target model; optional")
+	targetField := flag.String("target-field", "", "vector field to write the new embeddings to (required)")
+	deployment := flag.String("deployment", cfg.OpenAIDeployment, "Azure OpenAI deployment of the target model")
+	dims := flag.Int("dims", cfg.EmbeddingDims, "dimensions of the target model's vectors")
+	requestDims := flag.Bool("request-dimensions", false, "send -dims as the dimensions parameter of each embeddings call (text-embedding-3 models only)")
+	batchSize := flag.Int("batch-size", cfg.LoadBatchSize, "documents per embeddings call and write, 1-100")
+	flag.Parse()
+
+	if *targetModel == "" || *targetField == "" {
+		log.Fatal("-target-model and -target-field are required")
+	}
+
+	var embedOpts []query.EmbeddingOption
+	if *requestDims {
+		if err := config.CheckShortenable(*targetModel, *dims); err != nil {
+			log.Fatalf("-request-dimensions: %v", err)
+		}
+		embedOpts = append(embedOpts, query.WithDimensions(*dims))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var clients *client.Clients
+	switch {
+	case cfg.UseOpenAIKey():
+		clients, err = client.NewClientsWithKey(cfg.CosmosEndpoint, cfg.OpenAIEndpoint, cfg.OpenAIKey)
+	case cfg.UseManagedIdentity():
+		clients, err = client.NewClientsWithManagedIdentity(cfg.CosmosEndpoint, cfg.OpenAIEndpoint, cfg.ManagedIdentityClientID)
+	default:
+		clients, err = client.NewClientsPasswordless(cfg.CosmosEndpoint, cfg.OpenAIEndpoint)
+	}
+	if err != nil {
+		log.Fatalf("Failed to initialize clients: %v", err)
+	}
+	if err := clients.CheckOpenAICredential(ctx); err != nil {
+		log.Fatalf("Azure OpenAI authentication: %v", err)
+	}
+
+	database, err := clients.Cosmos.NewDatabase(cfg.DbName)
+	if err != nil {
+		log.Fatalf("Failed to get database %q: %v", cfg.DbName, err)
+	}
+	container, err := database.NewContainer(cfg.ContainerName)
+	if err != nil {
+		log.Fatalf("Failed to get container %q: %v", cfg.ContainerName, err)
+	}
+
+	// Searches use the field a previous migration switched to, if any, and
+	// EMBEDDED_FIELD otherwise.
+	currentField := cfg.EmbeddedField
+	active, err := data.GetActiveEmbedding(ctx, container)
+	if err != nil {
+		log.Fatalf("Failed to read the active embedding: %v", err)
+	}
+	if active != nil {
+		currentField = active.Field
+	}
+	if *targetField == currentField {
+		log.Fatalf("-target-field must differ from the field searches use (%s) so they keep working during the migration", currentField)
+	}
+
+	// The target field needs its own vector policy before anything is
+	// written to it, or the new vectors would not be indexed.
+	err = query.VerifyVectorPolicy(ctx, container, query.VectorPolicySpec{
+		EmbeddedField:    *targetField,
+		Dimensions:       *dims,
+		DistanceFunction: cfg.DistanceFunction,
+		IndexType:        cfg.AlgorithmDisplay,
+	})
+	if err != nil {
+		log.Fatalf("Vector policy check for %s failed: %v", *targetField, err)
+	}
+
+	embed := func(ctx context.Context, texts []string) ([][]float32, error) {
+		return query.GenerateEmbeddingsConcurrent(ctx, clients.OpenAI, texts, *deployment, 0, cfg.EmbeddingConcurrency, embedOpts...)
+	}
+	target := data.MigrationTarget{
+		Field: *targetField,
+		Model: data.ModelInfo{Model: *targetModel, Version: *targetVersion},
+	}
+	result, err := data.MigrateEmbeddings(ctx, container, target, embed, *batchSize)
+	if result != nil {
+		fmt.Printf("Migrated %d documents (%.2f RUs)\n", result.MigratedCount, result.RequestCharge)
+	}
+	if err != nil {
+		log.Fatalf("Migration stopped: %v; run the command again to resume", err)
+	}
+
+	if !result.Complete() {
+		fmt.Printf("%d documents were written during the migration and still need it; run the command again before switching\n", result.Remaining)
+		return
+	}
+	// Every document has a vector from the new model, so switch searches
+	// and loads over. Until now they kept using the current field.
+	err = data.SetActiveEmbedding(ctx, container, data.ActiveEmbedding{
+		Field:             *targetField,
+		Model:             target.Model,
+		Dimensions:        *dims,
+		Deployment:        *deployment,
+		RequestDimensions: *requestDims,
+	})
+	if err != nil {
+		log.Fatalf("Every document was migrated, but switching to %s failed: %v; run the command again to retry", *targetField, err)
+	}
+	fmt.Printf("\nEvery document has a vector from the new model. Searches and loads now use %s with %s.\n", *targetField, *targetModel)
+	fmt.Println("The switch is recorded in the container and overrides these settings, which you can update to match:")
+	fmt.Printf("  EMBEDDED_FIELD=%s\n", *targetField)
+	fmt.Printf("  EMBEDDING_DIMENSIONS=%d\n", *dims)
+	fmt.Printf("  EMBEDDING_REQUEST_DIMENSIONS=%t\n", *requestDims)
+	fmt.Printf("  AZURE_OPENAI_EMBEDDING_DEPLOYMENT=%s\n", *deployment)
+	fmt.Printf("  AZURE_OPENAI_EMBEDDING_MODEL=%s\n", *targetModel)
+	if *targetVersion != "" {
+		fmt.Printf("  AZURE_OPENAI_EMBEDDING_MODEL_VERSION=%s\n", *targetVersion)
+	}
+}
@@ -1,85 +1,516 @@
-// Package main is the entry point for the Cosmos DB NoSQL vector search sample.
-// It loads configuration, initializes Azure clients, inserts hotel data, generates
-// an embedding for a search query, and performs a vector-similarity search.
-package main
-
-import (
-	"context"
-	"fmt"
-	"log"
-	"os"
-
-	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/client"
-	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/config"
-	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/data"
-	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
-)
-
-func main() {
-	ctx := context.Background()
-
-	// --- Load configuration ---
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Fatalf("Configuration error: %v", err)
-	}
-
-	fmt.Println("\n📊 Vector Search Algorithm:", cfg.AlgorithmDisplay)
-	fmt.Println("📏 Distance Function:", cfg.DistanceFunction)
-	fmt.Println("📦 Container:", cfg.ContainerName)
-
-	// --- Initialize Azure clients (passwordless) ---
-	fmt.Println("\nInitializing Azure clients...")
-
-	var clients *client.Clients
-	openAIKey := os.Getenv("AZURE_OPENAI_EMBEDDING_KEY")
-	if openAIKey != "" {
-		clients, err = client.NewClientsWithKey(cfg.CosmosEndpoint, cfg.OpenAIEndpoint, openAIKey)
-	} else {
-		clients, err = client.NewClientsPasswordless(cfg.CosmosEndpoint, cfg.OpenAIEndpoint)
-	}
-	if err != nil {
-		log.Fatalf("Failed to initialize clients: %v", err)
-	}
-
-	// --- Get database and container references ---
-	database, err := clients.Cosmos.NewDatabase(cfg.DbName)
-	if err != nil {
-		log.Fatalf("Failed to get database %q: %v", cfg.DbName, err)
-	}
-	fmt.Printf("Connected to database: %s\n", cfg.DbName)
-
-	container, err := database.NewContainer(cfg.ContainerName)
-	if err != nil {
-		log.Fatalf("Failed to get container %q: %v", cfg.ContainerName, err)
-	}
-	fmt.Printf("Connected to container: %s\n", cfg.ContainerName)
-
-	// --- Load and insert hotel data ---
-	hotels, err := data.LoadHotelsJSON(cfg.DataFile)
-	if err != nil {
-		log.Fatalf("Failed to load hotel data: %v", err)
-	}
-
-	_, err = data.InsertData(ctx, container, hotels)
-	if err != nil {
-		log.Fatalf("Failed to insert data: %v", err)
-	}
-
-	// --- Generate embedding for the search query ---
-	fmt.Printf("Generating embedding for query: %q\n", cfg.Query)
-	embedding, err := query.GenerateEmbedding(ctx, clients.OpenAI, cfg.Query, cfg.OpenAIDeployment)
-	if err != nil {
-		log.Fatalf("Failed to generate query embedding: %v", err)
-	}
-	fmt.Printf("Embedding generated (%d dimensions)\n", len(embedding))
-
-	// --- Execute vector search ---
-	results, requestCharge, err := query.ExecuteVectorSearch(ctx, container, embedding, cfg.EmbeddedField)
-	if err != nil {
-		log.Fatalf("Vector search failed: %v", err)
-	}
-
-	query.PrintSearchResults(results, requestCharge)
-	fmt.Println("Vector search completed successfully!")
-}
+// Package main is the entry point for the Cosmos DB NoSQL vector search sample.
+// It loads configuration, initializes Azure clients, inserts hotel data, generates
+// an embedding for a search query, and performs a vector-similarity search.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/client"
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/config"
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/data"
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/embedcache"
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
+)
+
+func main() {
+	force := flag.Bool("force", false, "regenerate every hotel's embedding instead of reusing unchanged ones")
+	dryRun := flag.Bool("dry-run", false, "report what loading would embed and cost, without calling Azure OpenAI or writing")
+	flag.Parse()
+
+	// Ctrl+C cancels ctx, which every Cosmos DB and Azure OpenAI call in run
+	// receives, so an in-flight query or load stops instead of running on.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	// Every Azure OpenAI call adds its tokens to usage, which is reported
+	// however the run ends.
+	usage := &query.Usage{}
+	err := run(query.WithUsage(ctx, usage), *force, *dryRun)
+	stop()
+	query.PrintUsage(usage.Report())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run loads the configuration and data and runs the search, returning the
+// first error that stops it.
+func run(ctx context.Context, force, dryRun bool) error {
+	// --- Load configuration ---
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+
+	// --- Configure logging ---
+	// Diagnostics (activity IDs, per-item failures) go to stderr through slog;
+	// DEBUG=true lowers the level so per-page and per-item details show up.
+	// Replace the default logger with a JSON handler for machine-readable logs.
+	level := slog.LevelInfo
+	if cfg.Debug {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	fmt.Println("\n📊 Vector Search Algorithm:", cfg.AlgorithmDisplay)
+	fmt.Println("📏 Distance Function:", cfg.DistanceFunction)
+	fmt.Println("📦 Container:", cfg.ContainerName)
+
+	// --- Initialize Azure clients (passwordless) ---
+	fmt.Println("\nInitializing Azure clients...")
+
+	var clients *client.Clients
+	switch {
+	case cfg.UseOpenAIKey():
+		clients, err = client.NewClientsWithKey(cfg.CosmosEndpoint, cfg.OpenAIEndpoint, cfg.OpenAIKey)
+	case cfg.UseManagedIdentity():
+		clients, err = client.NewClientsWithManagedIdentity(cfg.CosmosEndpoint, cfg.OpenAIEndpoint, cfg.ManagedIdentityClientID)
+	default:
+		clients, err = client.NewClientsPasswordless(cfg.CosmosEndpoint, cfg.OpenAIEndpoint)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize clients: %w", err)
+	}
+	if err := clients.CheckOpenAICredential(ctx); err != nil {
+		return fmt.Errorf("Azure OpenAI authentication: %w", err)
+	}
+	// --- Get database and container references ---
+	database, err := clients.Cosmos.NewDatabase(cfg.DbName)
+	if err != nil {
+		return fmt.Errorf("failed to get database %q: %w", cfg.DbName, err)
+	}
+	fmt.Printf("Connected to database: %s\n", cfg.DbName)
+
+	container, err := database.NewContainer(cfg.ContainerName)
+	if err != nil {
+		return fmt.Errorf("failed to get container %q: %w", cfg.ContainerName, err)
+	}
+	fmt.Printf("Connected to container: %s\n", cfg.ContainerName)
+
+	// --- Use the embedding a completed migration switched to ---
+	active, err := data.GetActiveEmbedding(ctx, container)
+	if err != nil {
+		return fmt.Errorf("failed to read the active embedding: %w%s", err, setupHint(err))
+	}
+	if active != nil {
+		if active.Field != cfg.EmbeddedField || active.Model.Model != cfg.EmbeddingModel {
+			fmt.Printf("Using the active embedding recorded by migrate-embeddings: %s in %s (%d dimensions, deployment %s)\n",
+				active.Model.Model, active.Field, active.Dimensions, active.Deployment)
+		}
+		cfg.UseEmbedding(active.Field, active.Dimensions, active.RequestDimensions, active.Deployment, active.Model.Model, active.Model.Version)
+	}
+	// Only now is the model known, whether from the configuration or the
+	// active embedding.
+	if cfg.RequestDimensions {
+		if err := config.CheckShortenable(cfg.EmbeddingModel, cfg.EmbeddingDims); err != nil {
+			return fmt.Errorf("EMBEDDING_REQUEST_DIMENSIONS: %w", err)
+		}
+	}
+
+	// --- Check the container's vector policy matches the configuration ---
+	err = query.VerifyVectorPolicy(ctx, container, query.VectorPolicySpec{
+		EmbeddedField:    cfg.EmbeddedField,
+		Dimensions:       cfg.EmbeddingDims,
+		DistanceFunction: cfg.DistanceFunction,
+		IndexType:        cfg.AlgorithmDisplay,
+	})
+	if err != nil {
+		return fmt.Errorf("vector policy check failed: %w%s", err, setupHint(err))
+	}
+
+	// --- Wait for the vector index to finish building ---
+	// A container whose indexing policy just changed answers queries before
+	// the new vector index is built, with results that can be incomplete.
+	if cfg.IndexReadyTimeout > 0 {
+		fmt.Println("Waiting for the vector index to be ready...")
+		waitCtx, cancel := context.WithTimeout(ctx, cfg.IndexReadyTimeout)
+		err = query.WaitForIndexReady(waitCtx, container, cfg.EmbeddedField, 5*time.Second)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("vector index not ready: %w%s", err, setupHint(err))
+		}
+	}
+
+	// With EMBEDDING_REQUEST_DIMENSIONS the model shortens its vectors to the
+	// dimensions the container was created for.
+	var embedOpts []query.EmbeddingOption
+	if cfg.RequestDimensions {
+		embedOpts = append(embedOpts, query.WithDimensions(cfg.EmbeddingDims))
+	}
+
+	// --- Generate embedding for the search query ---
+	// This happens before loading data so a deployment whose dimensions don't
+	// match the container fails fast.
+	var embedding []float32
+	if cfg.SearchMode != query.SearchModeText && !dryRun {
+		fmt.Printf("Generating embedding for query: %q\n", cfg.Query)
+		var cache embedcache.Cache
+		switch cfg.EmbeddingCache {
+		case "memory":
+			cache = embedcache.NewLRU(cfg.EmbeddingCacheSize)
+		case "disk":
+			if cache, err = embedcache.NewDisk(cfg.EmbeddingCacheDir); err != nil {
+				return fmt.Errorf("configuration error: EMBEDDING_CACHE_DIR: %w", err)
+			}
+		}
+		embedding, err = query.GenerateEmbeddingCached(ctx, clients.OpenAI, cache, cfg.Query, cfg.OpenAIDeployment, embedOpts...)
+		if err != nil {
+			return fmt.Errorf("failed to generate query embedding: %w%s", err, setupHint(err))
+		}
+		if cache != nil {
+			stats := cache.Stats()
+			slog.DebugContext(ctx, "embedding cache", slog.String("cache", cfg.EmbeddingCache),
+				slog.Int64("hits", stats.Hits), slog.Int64("misses", stats.Misses))
+		}
+		if len(embedding) != cfg.EmbeddingDims {
+			return fmt.Errorf("embedding deployment %q returns %d dimensions but EMBEDDING_DIMENSIONS is %d; "+
+				"set EMBEDDING_DIMENSIONS to match a container created for this model, or use a deployment of the model the container was built for",
+				cfg.OpenAIDeployment, len(embedding), cfg.EmbeddingDims)
+		}
+		fmt.Printf("Embedding generated (%d dimensions)\n", len(embedding))
+	}
+
+	// --- Load and insert hotel data ---
+	// Hotels without a vector are embedded from EMBEDDING_TEMPLATE, unless the
+	// stored document was embedded from the same text; -force re-embeds
+	// everything. With PRECOMPUTED_EMBEDDINGS every hotel must bring its own
+	// vector instead. Then they are upserted in batches; hotels already
+	// stored with the same content are skipped, so rerunning the sample
+	// doesn't rewrite the container. -dry-run only reports what would be
+	// embedded.
+	templateSource := cfg.EmbeddingTemplate
+	if templateSource == "" {
+		templateSource = data.DefaultEmbeddingTemplate
+	}
+	embeddingTemplate, err := data.NewEmbeddingTemplate(templateSource)
+	if err != nil {
+		return fmt.Errorf("configuration error: EMBEDDING_TEMPLATE: %w", err)
+	}
+	embedBatch := func(ctx context.Context, texts []string) ([][]float32, error) {
+		return query.GenerateEmbeddingsConcurrent(ctx, clients.OpenAI, texts, cfg.OpenAIDeployment, 0, cfg.EmbeddingConcurrency, embedOpts...)
+	}
+	modelInfo := data.ModelInfo{Model: cfg.EmbeddingModel, Version: cfg.EmbeddingModelVersion}
+	bulkOpts := []data.BulkOption{
+		data.WithChunkSize(cfg.LoadBatchSize),
+		data.WithModelInfo(modelInfo),
+	}
+	// One progress line for the whole load, which BulkUpsert may see in
+	// several batches. A streamed file's total is not known up front.
+	progress := data.NewProgress(0, data.ConsoleProgress(os.Stdout))
+	if !force {
+		bulkOpts = append(bulkOpts, data.WithSkipUnchanged())
+	}
+	var plan dryRunPlan // dry-run totals across batches
+	store := func(ctx context.Context, hotels []data.Hotel) error {
+		if cfg.PrecomputedEmbeddings {
+			// Vectors come from the data file; Azure OpenAI is never called.
+			if err := data.RequireVectors(hotels, cfg.EmbeddedField); err != nil {
+				return err
+			}
+			if dryRun {
+				plan.hotels.SkippedCount += len(hotels)
+				for _, h := range hotels {
+					plan.hotels.SkippedIDs = append(plan.hotels.SkippedIDs, h.HotelID)
+				}
+				return plan.check(ctx, container, hotels, cfg.EmbeddedField)
+			}
+		} else if dryRun {
+			r, err := data.PlanEmbeddings(ctx, container, hotels, cfg.EmbeddedField, embeddingTemplate, force)
+			if err != nil {
+				return err
+			}
+			plan.hotels.EmbeddedCount += r.EmbeddedCount
+			plan.hotels.SkippedCount += r.SkippedCount
+			plan.hotels.SkippedIDs = append(plan.hotels.SkippedIDs, r.SkippedIDs...)
+			plan.hotels.EstimatedTokens += r.EstimatedTokens
+			plan.hotels.RequestCharge += r.RequestCharge
+			if cfg.ChunkMaxTokens > 0 {
+				c, err := data.PlanChunks(ctx, container, hotels, cfg.EmbeddedField, cfg.ChunkMaxTokens, cfg.ChunkOverlap, modelInfo, force)
+				if err != nil {
+					return err
+				}
+				plan.chunks.ChunkCount += c.ChunkCount
+				plan.chunks.EmbeddedCount += c.EmbeddedCount
+				plan.chunks.EstimatedTokens += c.EstimatedTokens
+				plan.chunks.RequestCharge += c.RequestCharge
+			}
+			return plan.check(ctx, container, hotels, cfg.EmbeddedField)
+		}
+		if !cfg.PrecomputedEmbeddings {
+			if _, err := data.EmbedChanged(ctx, container, hotels, cfg.EmbeddedField, embedBatch, embeddingTemplate, force); err != nil {
+				return fmt.Errorf("failed to embed hotel data: %w", err)
+			}
+		}
+		// Invalid hotels are reported in Failed and skipped; the rest are
+		// still written, so they don't stop the load.
+		loaded, err := data.BulkUpsert(ctx, container, hotels, cfg.EmbeddedField, append(bulkOpts, data.WithSharedProgress(progress))...)
+		var invalid data.ValidationErrors
+		if err != nil && !errors.As(err, &invalid) {
+			return err
+		}
+		for _, f := range loaded.Failed {
+			fmt.Printf("  failed %s: %v\n", f.HotelID, f.Err)
+		}
+		if cfg.ChunkMaxTokens > 0 {
+			if len(invalid) > 0 {
+				skip := make(map[string]bool, len(invalid))
+				for _, v := range invalid {
+					skip[v.HotelID] = true
+				}
+				hotels = slices.DeleteFunc(slices.Clone(hotels), func(h data.Hotel) bool { return skip[h.HotelID] })
+			}
+			if _, err := data.UpsertChunks(ctx, container, hotels, cfg.EmbeddedField, embedBatch, cfg.ChunkMaxTokens, cfg.ChunkOverlap, modelInfo, force); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch strings.ToLower(filepath.Ext(cfg.DataFile)) {
+	case ".jsonl", ".ndjson":
+		// Streamed one batch at a time, so large files never sit in memory.
+		_, err = data.LoadHotelsJSONL(ctx, cfg.DataFile, cfg.LoadBatchSize, store)
+	case ".csv":
+		mapping := data.DefaultCSVMapping
+		mapping.TagSeparator = cfg.CSVTagSeparator
+		for field, header := range cfg.CSVColumns {
+			if err := mapping.Set(field, header); err != nil {
+				return fmt.Errorf("configuration error: CSV_COLUMNS: %w", err)
+			}
+		}
+		var hotels []data.Hotel
+		if hotels, err = data.LoadHotelsCSV(cfg.DataFile, mapping); err == nil {
+			progress = data.NewProgress(len(hotels), data.ConsoleProgress(os.Stdout))
+			err = store(ctx, hotels)
+		}
+	default:
+		var hotels []data.Hotel
+		if hotels, err = data.LoadHotelsJSON(cfg.DataFile); err == nil {
+			progress = data.NewProgress(len(hotels), data.ConsoleProgress(os.Stdout))
+			err = store(ctx, hotels)
+		}
+	}
+	progress.Finish()
+	if err != nil {
+		return fmt.Errorf("failed to load data: %w%s", err, setupHint(err))
+	}
+	if dryRun {
+		plan.print(cfg)
+		return nil
+	}
+
+	// --- Show what the container holds ---
+	stats, err := query.GetContainerStats(ctx, container)
+	if err != nil {
+		slog.WarnContext(ctx, "could not read container stats", slog.Any("error", err))
+	} else {
+		query.PrintContainerStats(stats, cfg.EmbeddedField)
+		if stats.DocumentCount == 0 {
+			return fmt.Errorf("container %q has no documents to search; check DATA_FILE_WITH_VECTORS and the insert errors above, then run the sample again to load the data", cfg.ContainerName)
+		}
+	}
+
+	// --- Build search options ---
+	var searchOpts []query.SearchOption
+	if cfg.MinScore != nil {
+		searchOpts = append(searchOpts, query.WithMinScore(*cfg.MinScore))
+	}
+	if cfg.ChunkMaxTokens > 0 {
+		searchOpts = append(searchOpts, query.WithCollapseChunks())
+	}
+	if cfg.SearchListSize > 0 {
+		searchOpts = append(searchOpts, query.WithSearchListSizeMultiplier(cfg.SearchListSize))
+	}
+	if cfg.QueryTimeout > 0 {
+		searchOpts = append(searchOpts, query.WithTimeout(cfg.QueryTimeout))
+	}
+
+	// --- Full-text search needs no embedding ---
+	if cfg.SearchMode == query.SearchModeText {
+		results, requestCharge, err := query.ExecuteTextSearch(ctx, container, query.ExtractSearchTerms(cfg.Query), searchOpts...)
+		if err != nil {
+			return fmt.Errorf("full-text search failed: %w%s", err, setupHint(err))
+		}
+
+		query.PrintSearchResults(results, requestCharge)
+		fmt.Println("Full-text search completed successfully!")
+		return nil
+	}
+
+	// --- Execute hybrid search ---
+	if cfg.SearchMode == query.SearchModeHybrid {
+		hybridOpts := append(searchOpts, query.WithHybridWeights(cfg.HybridVectorWeight, cfg.HybridTextWeight))
+		results, requestCharge, err := query.ExecuteHybridSearch(ctx, container, cfg.Query, embedding, cfg.EmbeddedField, cfg.DistanceFunction, hybridOpts...)
+		if err != nil {
+			return fmt.Errorf("hybrid search failed: %w%s", err, setupHint(err))
+		}
+
+		query.PrintHybridResults(results, requestCharge)
+		fmt.Println("Hybrid search completed successfully!")
+		return nil
+	}
+
+	// --- Execute vector search ---
+	results, requestCharge, err := query.ExecuteVectorSearch(ctx, container, embedding, cfg.EmbeddedField, cfg.DistanceFunction, searchOpts...)
+	if err != nil {
+		return fmt.Errorf("vector search failed: %w%s", err, setupHint(err))
+	}
+
+	query.PrintSearchResults(results, requestCharge)
+
+	// --- Optionally ask the chat model why each hotel matched ---
+	if cfg.ExplainResults {
+		gen := query.DefaultExplanationConfig()
+		if cfg.ChatTemperature != nil {
+			t := float32(*cfg.ChatTemperature)
+			gen.Temperature = &t
+		}
+		if cfg.ChatTopP != nil {
+			p := float32(*cfg.ChatTopP)
+			gen.TopP = &p
+		}
+		if cfg.ChatMaxTokens > 0 {
+			n := int32(cfg.ChatMaxTokens)
+			gen.MaxTokens = &n
+		}
+		gen.Seed = cfg.ChatSeed
+		gen.Stop = cfg.ChatStop
+		explained, err := query.ExplainResults(ctx, clients.OpenAI, cfg.ChatDeployment, cfg.Query, results, gen)
+		if err != nil {
+			slog.WarnContext(ctx, "could not explain results", slog.Any("error", err))
+		} else {
+			query.PrintExplanations(explained)
+		}
+	}
+
+	// --- In debug mode, show how the query was executed ---
+	if cfg.Debug {
+		explain, err := query.ExplainVectorSearch(ctx, container, embedding, cfg.EmbeddedField, cfg.DistanceFunction, searchOpts...)
+		if err != nil {
+			slog.WarnContext(ctx, "explain failed", slog.Any("error", err))
+		} else {
+			slog.DebugContext(ctx, "vector search plan: "+explain.Summary(),
+				slog.String("indexMetrics", explain.IndexMetrics),
+			)
+		}
+	}
+
+	// --- Optionally compare against an exact search ---
+	if cfg.MeasureRecall {
+		exactOpts := append(searchOpts, query.WithBruteForce())
+		exact, exactCharge, err := query.ExecuteVectorSearch(ctx, container, embedding, cfg.EmbeddedField, cfg.DistanceFunction, exactOpts...)
+		if err != nil {
+			return fmt.Errorf("exact search failed: %w%s", err, setupHint(err))
+		}
+		fmt.Printf("Recall@%d: %.2f (exact search charge: %.2f RUs)\n\n", len(exact), query.Recall(exact, results), exactCharge)
+	}
+
+	fmt.Println("Vector search completed successfully!")
+	return nil
+}
+
+// dryRunPlan collects what a -dry-run load would do across batches.
+type dryRunPlan struct {
+	hotels  data.EmbedResult
+	chunks  data.ChunkResult
+	invalid data.ValidationErrors
+}
+
+// check validates hotels as BulkUpsert would. Hotels that are still to be
+// embedded have no vector yet, so only their other fields are checked.
+func (p *dryRunPlan) check(ctx context.Context, container *azcosmos.ContainerClient, hotels []data.Hotel, embeddedField string) error {
+	dims, err := query.PolicyDimensions(ctx, container, embeddedField)
+	if err != nil {
+		return err
+	}
+	for _, h := range hotels {
+		d := dims
+		if len(h.DescriptionVector) == 0 {
+			d = 0
+		}
+		var verr *data.ValidationError
+		if errors.As(h.Validate(d), &verr) {
+			p.invalid = append(p.invalid, verr)
+		}
+	}
+	return nil
+}
+
+// print reports the plan: what would be embedded, how long it would take,
+// and which hotels would be rejected.
+func (p *dryRunPlan) print(cfg *config.Config) {
+	tokens := p.hotels.EstimatedTokens + p.chunks.EstimatedTokens
+	calls, d := query.EstimateEmbeddingTime(p.hotels.EmbeddedCount+p.chunks.EmbeddedCount, tokens, 0, cfg.EmbeddingConcurrency, cfg.EmbeddingTokensPerMinute)
+
+	fmt.Println("\n--- Dry run: nothing was embedded or written ---")
+	fmt.Printf("Hotels to embed:  %d new/changed, %d skipped as unchanged\n", p.hotels.EmbeddedCount, p.hotels.SkippedCount)
+	if cfg.ChunkMaxTokens > 0 {
+		fmt.Printf("Chunks to embed:  %d new/changed of %d (stale chunks to delete are not counted)\n", p.chunks.EmbeddedCount, p.chunks.ChunkCount)
+	}
+	fmt.Printf("Embedding calls:  %d\n", calls)
+	fmt.Printf("Estimated tokens: %d\n", tokens)
+	if cfg.EmbeddingTokensPerMinute > 0 {
+		fmt.Printf("Estimated time:   %s at %d concurrent calls, %d tokens/minute\n",
+			d.Round(time.Second), cfg.EmbeddingConcurrency, cfg.EmbeddingTokensPerMinute)
+	} else {
+		fmt.Printf("Estimated time:   %s at %d concurrent calls; the token rate limit is unknown, set EMBEDDING_TOKENS_PER_MINUTE to include it\n",
+			d.Round(time.Second), cfg.EmbeddingConcurrency)
+	}
+	fmt.Printf("Request charge:   %.2f RUs to read stored hashes\n", p.hotels.RequestCharge+p.chunks.RequestCharge)
+
+	const maxListed = 20
+	if ids := p.hotels.SkippedIDs; len(ids) <= maxListed || cfg.Debug {
+		fmt.Printf("Skipped hotels:   %s\n", strings.Join(ids, ", "))
+	} else {
+		fmt.Printf("Skipped hotels:   %s, and %d more (set DEBUG=true to list all)\n",
+			strings.Join(ids[:maxListed], ", "), len(ids)-maxListed)
+	}
+	if len(p.invalid) == 0 {
+		fmt.Println("Invalid hotels:   none")
+		return
+	}
+	fmt.Printf("Invalid hotels:   %d would be rejected by BulkUpsert\n", len(p.invalid))
+	for i, v := range p.invalid {
+		if i == maxListed && !cfg.Debug {
+			fmt.Printf("  and %d more (set DEBUG=true to list all)\n", len(p.invalid)-maxListed)
+			break
+		}
+		fmt.Printf("  %v\n", v)
+	}
+}
+
+// setupHint returns advice for errors that usually mean the environment is
+// not set up yet, or an empty string for any other error.
+func setupHint(err error) string {
+	switch {
+	case errors.Is(err, query.ErrIndexNotFound):
+		return "\nHint: vector mode needs a vector index on EMBEDDED_FIELD; text and hybrid modes also need a full-text policy and full-text indexes on /HotelName and /Description."
+	case errors.Is(err, query.ErrContainerNotFound):
+		return "\nHint: check AZURE_COSMOSDB_DATABASENAME and AZURE_COSMOSDB_CONTAINERNAME, or run azd up to create the database and containers."
+	case errors.Is(err, query.ErrDeploymentNotFound):
+		return "\nHint: check AZURE_OPENAI_EMBEDDING_DEPLOYMENT (and AZURE_OPENAI_CHAT_DEPLOYMENT for explanations) against the deployments of the Azure OpenAI resource."
+	case errors.Is(err, query.ErrAuth):
+		return "\nHint: run az login, and make sure your identity has the Cosmos DB Built-in Data Contributor and Cognitive Services OpenAI User roles."
+	case errors.Is(err, data.ErrMissingVectors):
+		return "\nHint: with PRECOMPUTED_EMBEDDINGS=true every hotel needs a DescriptionVector; fix the export, or unset PRECOMPUTED_EMBEDDINGS to embed the missing ones."
+	case errors.Is(err, query.ErrIndexNotReady):
+		return "\nHint: large containers can take a while to index; raise INDEX_READY_TIMEOUT, or unset it to search while the index builds."
+	case errors.Is(err, query.ErrTimeout):
+		return "\nHint: the search took too long; narrow it with a filter or raise QUERY_TIMEOUT."
+	case errors.Is(err, query.ErrThrottled):
+		return "\nHint: the request was throttled after retries; wait and run again, or raise the container throughput or the deployment's quota."
+	}
+	return ""
+}
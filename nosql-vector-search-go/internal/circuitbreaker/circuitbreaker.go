@@ -0,0 +1,168 @@
+// Package circuitbreaker stops calls to a failing service for a while, so
+// callers fail fast instead of each waiting for a timeout.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// ErrCircuitOpen is returned instead of calling the service while the circuit
+// is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// State is the state of a CircuitBreaker.
+type State int
+
+const (
+	// Closed lets every call through and counts consecutive failures.
+	Closed State = iota
+	// Open rejects every call with ErrCircuitOpen until the recovery
+	// timeout has passed.
+	Open
+	// HalfOpen lets a single probe call through; its outcome closes or
+	// reopens the circuit.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// CircuitBreaker opens after FailureThreshold consecutive failed calls and
+// rejects calls until RecoveryTimeout has passed. It then lets one probe call
+// through: success closes the circuit, failure opens it again. It is safe for
+// concurrent use.
+//
+// A CircuitBreaker is also an azcore policy.Policy; see Do.
+type CircuitBreaker struct {
+	failureThreshold int
+	recoveryTimeout  time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New returns a closed CircuitBreaker that opens after failureThreshold
+// consecutive failures and allows a probe after recoveryTimeout.
+func New(failureThreshold int, recoveryTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: max(failureThreshold, 1),
+		recoveryTimeout:  recoveryTimeout,
+	}
+}
+
+// State returns the current state of the circuit.
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == Open && time.Since(cb.openedAt) >= cb.recoveryTimeout {
+		return HalfOpen
+	}
+	return cb.state
+}
+
+// Execute runs fn if the circuit allows it and records the outcome. It
+// returns ErrCircuitOpen without calling fn while the circuit is open. A call
+// canceled by its caller says nothing about the service, so it is not
+// recorded.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	if err := cb.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	if errors.Is(err, context.Canceled) {
+		cb.release()
+	} else {
+		cb.record(err == nil)
+	}
+	return err
+}
+
+// Do implements policy.Policy, so the breaker can be added to an Azure SDK
+// client's PerCallPolicies. A call fails when the request errors or the final
+// response is a 5xx; as a per-call policy it sees the outcome after the
+// client's own retries.
+func (cb *CircuitBreaker) Do(req *policy.Request) (*http.Response, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := req.Next()
+	switch {
+	case errors.Is(err, context.Canceled):
+		cb.release()
+	case err != nil:
+		cb.record(false)
+	default:
+		cb.record(resp.StatusCode < http.StatusInternalServerError)
+	}
+	return resp, err
+}
+
+// allow reports whether a call may proceed, moving an open circuit to
+// half-open once the recovery timeout has passed.
+func (cb *CircuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case Open:
+		if time.Since(cb.openedAt) < cb.recoveryTimeout {
+			return ErrCircuitOpen
+		}
+		cb.state = HalfOpen
+		cb.probing = true
+		return nil
+	case HalfOpen:
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+	}
+	return nil
+}
+
+// release ends a call without recording an outcome. A canceled half-open
+// probe frees its slot, so the next call probes instead.
+func (cb *CircuitBreaker) release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+// record updates the circuit with the outcome of a call.
+func (cb *CircuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if success {
+		cb.state = Closed
+		cb.failures = 0
+		cb.probing = false
+		return
+	}
+
+	cb.failures++
+	if cb.state == HalfOpen || cb.failures >= cb.failureThreshold {
+		cb.state = Open
+		cb.openedAt = time.Now()
+		cb.probing = false
+	}
+}
@@ -0,0 +1,98 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errService = errors.New("service unavailable")
+
+func fail() error     { return errService }
+func succeed() error  { return nil }
+func canceled() error { return context.Canceled }
+
+func TestOpensAfterThreshold(t *testing.T) {
+	cb := New(2, time.Hour)
+	cb.Execute(fail)
+	if cb.State() != Closed {
+		t.Fatalf("state after one failure = %v, want closed", cb.State())
+	}
+	cb.Execute(fail)
+	if cb.State() != Open {
+		t.Fatalf("state after two failures = %v, want open", cb.State())
+	}
+	called := false
+	if err := cb.Execute(func() error { called = true; return nil }); !errors.Is(err, ErrCircuitOpen) || called {
+		t.Errorf("Execute while open = %v (called %v), want ErrCircuitOpen without a call", err, called)
+	}
+}
+
+func TestCanceledCallsAreNotRecorded(t *testing.T) {
+	cb := New(2, time.Hour)
+	cb.Execute(fail)
+	cb.Execute(canceled)
+	cb.Execute(fail)
+	if cb.State() != Open {
+		t.Errorf("state = %v, want open: a canceled call reset the failure count", cb.State())
+	}
+
+	cb = New(1, time.Hour)
+	for range 3 {
+		cb.Execute(canceled)
+	}
+	if cb.State() != Closed {
+		t.Errorf("state after canceled calls = %v, want closed", cb.State())
+	}
+}
+
+func TestCanceledProbeReleasesSlot(t *testing.T) {
+	cb := New(1, time.Millisecond)
+	cb.Execute(fail)
+	time.Sleep(5 * time.Millisecond)
+
+	if err := cb.Execute(canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("probe = %v, want context.Canceled", err)
+	}
+	if cb.State() != HalfOpen {
+		t.Fatalf("state after canceled probe = %v, want half-open", cb.State())
+	}
+
+	// The canceled probe neither closed the circuit nor kept the slot, so
+	// the next call is the probe and decides the state.
+	if err := cb.Execute(fail); !errors.Is(err, errService) {
+		t.Fatalf("second probe = %v, want it to run", err)
+	}
+	if cb.State() != Open {
+		t.Errorf("state after failed probe = %v, want open", cb.State())
+	}
+}
+
+func TestProbeClosesCircuit(t *testing.T) {
+	cb := New(1, time.Millisecond)
+	cb.Execute(fail)
+	time.Sleep(5 * time.Millisecond)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- cb.Execute(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+
+	<-started
+	if err := cb.Execute(succeed); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("call during the probe = %v, want ErrCircuitOpen", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if cb.State() != Closed {
+		t.Errorf("state after successful probe = %v, want closed", cb.State())
+	}
+}
@@ -1,60 +1,250 @@
-package client
-
-import (
-	"fmt"
-
-	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
-)
-
-// Clients holds the initialized Azure service clients.
-type Clients struct {
-	Cosmos *azcosmos.Client
-	OpenAI *azopenai.Client
-}
-
-// NewClientsPasswordless creates Cosmos DB and Azure OpenAI clients using
-// DefaultAzureCredential (passwordless / managed-identity authentication).
-func NewClientsPasswordless(cosmosEndpoint, openAIEndpoint string) (*Clients, error) {
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create DefaultAzureCredential: %w", err)
-	}
-
-	cosmosClient, err := azcosmos.NewClient(cosmosEndpoint, cred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Cosmos DB client: %w", err)
-	}
-
-	openAIClient, err := azopenai.NewClient(openAIEndpoint, cred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Azure OpenAI client: %w", err)
-	}
-
-	return &Clients{Cosmos: cosmosClient, OpenAI: openAIClient}, nil
-}
-
-// NewClientsWithKey creates Cosmos DB (passwordless) and Azure OpenAI (key-based) clients.
-// Use this when Azure OpenAI requires an API key instead of token credentials.
-func NewClientsWithKey(cosmosEndpoint, openAIEndpoint, openAIKey string) (*Clients, error) {
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create DefaultAzureCredential: %w", err)
-	}
-
-	cosmosClient, err := azcosmos.NewClient(cosmosEndpoint, cred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Cosmos DB client: %w", err)
-	}
-
-	keyCred := azcore.NewKeyCredential(openAIKey)
-
-	openAIClient, err := azopenai.NewClientWithKeyCredential(openAIEndpoint, keyCred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Azure OpenAI client with key: %w", err)
-	}
-
-	return &Clients{Cosmos: cosmosClient, OpenAI: openAIClient}, nil
-}
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/tracing"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/circuitbreaker"
+)
+
+// Clients holds the initialized Azure service clients. OpenAI is nil when the
+// constructor was given an empty Azure OpenAI endpoint, as when loading
+// precomputed embeddings.
+type Clients struct {
+	Cosmos *azcosmos.Client
+	OpenAI *azopenai.Client
+
+	// openAICred is the Microsoft Entra credential of OpenAI, or nil when it
+	// authenticates with a key.
+	openAICred azcore.TokenCredential
+}
+
+// openAIScope is the Microsoft Entra scope of Azure OpenAI tokens.
+const openAIScope = "https://cognitiveservices.azure.com/.default"
+
+// ErrNoOpenAICredential means no Microsoft Entra token could be obtained for
+// Azure OpenAI.
+var ErrNoOpenAICredential = errors.New("no Microsoft Entra credential for Azure OpenAI")
+
+// CheckOpenAICredential gets a Microsoft Entra token for Azure OpenAI, so a
+// missing sign-in fails at startup with advice instead of at the first
+// embeddings call. It returns nil when OpenAI authenticates with a key or
+// was not created. After this, the SDK's bearer token policy caches the token
+// and refreshes it before it expires.
+func (c *Clients) CheckOpenAICredential(ctx context.Context) error {
+	if c.OpenAI == nil || c.openAICred == nil {
+		return nil
+	}
+	_, err := c.openAICred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{openAIScope}})
+	if err != nil {
+		return fmt.Errorf("%w; sign in with az login, set AZURE_OPENAI_AUTH=managed-identity when running in Azure, "+
+			"or set AZURE_OPENAI_EMBEDDING_KEY if the resource allows key auth: %w", ErrNoOpenAICredential, err)
+	}
+	return nil
+}
+
+// Option configures how NewClientsPasswordless and NewClientsWithKey build
+// the Azure clients.
+type Option func(*options)
+
+type options struct {
+	cosmos azcosmos.ClientOptions
+	openAI azopenai.ClientOptions
+}
+
+// WithRetry sets the retry policy for Azure OpenAI calls. Throttled (429) and
+// transient (408, 5xx) responses and connection errors are retried up to
+// maxAttempts total tries, with exponential backoff and jitter starting at
+// baseDelay and capped at maxDelay. A Retry-After header from the service
+// takes precedence over the computed delay. Other 4xx responses are returned
+// without retrying, and cancelling the context stops the retry loop
+// immediately. A baseDelay of zero retries without waiting, which keeps
+// tests fast; see WithRetryTimeout to bound the total time.
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(o *options) {
+		// The SDK treats zero retries as "use the default", so a single
+		// attempt is spelled -1. A zero delay would be read as the default
+		// too, and a computed delay of zero as an overflow that waits
+		// maxDelay, so no delay is spelled as the smallest one.
+		retries := int32(maxAttempts - 1)
+		if retries <= 0 {
+			retries = -1
+		}
+		if baseDelay <= 0 {
+			baseDelay = time.Nanosecond
+		}
+		o.openAI.Retry = policy.RetryOptions{
+			MaxRetries:    retries,
+			RetryDelay:    baseDelay,
+			MaxRetryDelay: maxDelay,
+		}
+	}
+}
+
+// WithTracingProvider makes both clients emit a span for every service call
+// (embeddings requests, item writes, queries) through the given provider.
+// To export to OpenTelemetry, wrap a TracerProvider with azotel:
+//
+//	client.WithTracingProvider(azotel.NewTracingProvider(otel.GetTracerProvider(), nil))
+func WithTracingProvider(tp tracing.Provider) Option {
+	return func(o *options) {
+		o.cosmos.TracingProvider = tp
+		o.openAI.TracingProvider = tp
+	}
+}
+
+// WithCircuitBreaker routes every Azure OpenAI call through cb. Once cb has
+// seen enough consecutive failures (after retries), calls such as
+// GenerateEmbedding return circuitbreaker.ErrCircuitOpen immediately instead
+// of waiting on an endpoint that is down.
+func WithCircuitBreaker(cb *circuitbreaker.CircuitBreaker) Option {
+	return func(o *options) {
+		o.openAI.PerCallPolicies = append(o.openAI.PerCallPolicies, cb)
+	}
+}
+
+// PoolOptions sizes the HTTP connection pool the clients share. Zero fields
+// keep the Go defaults.
+type PoolOptions struct {
+	// MaxConnsPerHost caps the connections open to one endpoint, including
+	// ones in use; further requests wait for a free connection. Zero means
+	// no limit.
+	MaxConnsPerHost int
+	// MaxIdleConnsPerHost is how many idle connections to one endpoint are
+	// kept for reuse.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes connections that have been idle this long.
+	IdleConnTimeout time.Duration
+	// DialTimeout bounds how long opening a new connection may take.
+	DialTimeout time.Duration
+}
+
+// WithConnectionPool sends both clients' requests through one HTTP transport
+// configured by p, instead of the SDK's default of at most 10 idle
+// connections per host and no cap on open ones. Raise the limits for loads
+// with high EMBEDDING_CONCURRENCY, or cap MaxConnsPerHost on a small host.
+func WithConnectionPool(p PoolOptions) Option {
+	return func(o *options) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		transport.MaxConnsPerHost = p.MaxConnsPerHost
+		if p.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+			transport.MaxIdleConns = max(transport.MaxIdleConns, p.MaxIdleConnsPerHost)
+		}
+		if p.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = p.IdleConnTimeout
+		}
+		if p.DialTimeout > 0 {
+			transport.DialContext = (&net.Dialer{Timeout: p.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+		}
+
+		client := &http.Client{Transport: transport}
+		o.cosmos.Transport = client
+		o.openAI.Transport = client
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	// Log retried Azure OpenAI calls at debug level. Appended last, the
+	// per-call policy sits inside any WithRetryTimeout deadline.
+	o.openAI.PerCallPolicies = append(o.openAI.PerCallPolicies, retryLogPolicy{})
+	o.openAI.PerRetryPolicies = append(o.openAI.PerRetryPolicies, attemptPolicy{})
+	return o
+}
+
+// NewClientsPasswordless creates Cosmos DB and Azure OpenAI clients using
+// DefaultAzureCredential (passwordless / managed-identity authentication).
+func NewClientsPasswordless(cosmosEndpoint, openAIEndpoint string, opts ...Option) (*Clients, error) {
+	o := newOptions(opts)
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DefaultAzureCredential: %w", err)
+	}
+	return newClientsWithCredential(cosmosEndpoint, openAIEndpoint, cred, o)
+}
+
+// NewClientsWithManagedIdentity creates Cosmos DB and Azure OpenAI clients
+// that authenticate with the managed identity of the Azure host (App Service,
+// Container Apps, a VM, and so on). Pass the client ID of a user-assigned
+// identity, or "" for the system-assigned identity.
+//
+// Unlike DefaultAzureCredential it never falls back to developer credentials,
+// so a deployment without an identity fails at the first request instead of
+// running as someone else. Tokens are cached and refreshed before they expire
+// by the SDK's bearer token policy.
+func NewClientsWithManagedIdentity(cosmosEndpoint, openAIEndpoint, clientID string, opts ...Option) (*Clients, error) {
+	o := newOptions(opts)
+
+	var miOpts azidentity.ManagedIdentityCredentialOptions
+	if clientID != "" {
+		miOpts.ID = azidentity.ClientID(clientID)
+	}
+	cred, err := azidentity.NewManagedIdentityCredential(&miOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ManagedIdentityCredential: %w", err)
+	}
+	return newClientsWithCredential(cosmosEndpoint, openAIEndpoint, cred, o)
+}
+
+// newClientsWithCredential creates Cosmos DB and Azure OpenAI clients that
+// both authenticate with cred.
+func newClientsWithCredential(cosmosEndpoint, openAIEndpoint string, cred azcore.TokenCredential, o *options) (*Clients, error) {
+	cosmosClient, err := azcosmos.NewClient(cosmosEndpoint, cred, &o.cosmos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cosmos DB client: %w", err)
+	}
+
+	clients := &Clients{Cosmos: cosmosClient}
+	if openAIEndpoint == "" {
+		return clients, nil
+	}
+	if clients.OpenAI, err = azopenai.NewClient(openAIEndpoint, cred, &o.openAI); err != nil {
+		return nil, fmt.Errorf("failed to create Azure OpenAI client: %w", err)
+	}
+	clients.openAICred = cred
+	return clients, nil
+}
+
+// NewClientsWithKey creates Cosmos DB (passwordless) and Azure OpenAI (key-based) clients.
+// Use this when Azure OpenAI requires an API key instead of token credentials.
+func NewClientsWithKey(cosmosEndpoint, openAIEndpoint, openAIKey string, opts ...Option) (*Clients, error) {
+	o := newOptions(opts)
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DefaultAzureCredential: %w", err)
+	}
+
+	cosmosClient, err := azcosmos.NewClient(cosmosEndpoint, cred, &o.cosmos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cosmos DB client: %w", err)
+	}
+
+	clients := &Clients{Cosmos: cosmosClient}
+	if openAIEndpoint == "" {
+		return clients, nil
+	}
+	keyCred := azcore.NewKeyCredential(openAIKey)
+	if clients.OpenAI, err = azopenai.NewClientWithKeyCredential(openAIEndpoint, keyCred, &o.openAI); err != nil {
+		return nil, fmt.Errorf("failed to create Azure OpenAI client with key: %w", err)
+	}
+	return clients, nil
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+// fakeCredential hands out a fixed token and records the scopes asked for.
+type fakeCredential struct {
+	token string
+	err   error
+
+	mu     sync.Mutex
+	scopes [][]string
+}
+
+func (c *fakeCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.mu.Lock()
+	c.scopes = append(c.scopes, opts.Scopes)
+	c.mu.Unlock()
+	if c.err != nil {
+		return azcore.AccessToken{}, c.err
+	}
+	return azcore.AccessToken{Token: c.token, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// embeddingsServer answers every request with a one-dimensional embedding and
+// records the Authorization header of each request.
+func embeddingsServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var headers []string
+	// Bearer tokens are only sent over TLS.
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"embedding":[0.5],"index":0,"object":"embedding"}],"usage":{"prompt_tokens":1,"total_tokens":1}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(headers)
+	}
+}
+
+func embed(ctx context.Context, client *azopenai.Client) error {
+	_, err := client.GetEmbeddings(ctx, azopenai.EmbeddingsOptions{
+		Input:          []string{"hotel"},
+		DeploymentName: to.Ptr("test-deployment"),
+	}, nil)
+	return err
+}
+
+func TestCredentialSetsAuthorizationHeader(t *testing.T) {
+	server, headers := embeddingsServer(t)
+	cred := &fakeCredential{token: "test-token"}
+
+	o := newOptions(nil)
+	o.openAI.Transport = server.Client()
+	clients, err := newClientsWithCredential("https://fake.documents.azure.com:443/", server.URL, cred, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if err := embed(context.Background(), clients.OpenAI); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := headers(), []string{"Bearer test-token", "Bearer test-token"}; !slices.Equal(got, want) {
+		t.Errorf("Authorization headers = %q, want %q", got, want)
+	}
+
+	cred.mu.Lock()
+	defer cred.mu.Unlock()
+	// The bearer token policy caches the token, so the credential is asked
+	// once for both requests.
+	if len(cred.scopes) != 1 || !slices.Equal(cred.scopes[0], []string{openAIScope}) {
+		t.Errorf("token requests = %q, want one for %s", cred.scopes, openAIScope)
+	}
+}
+
+func TestCheckOpenAICredential(t *testing.T) {
+	o := newOptions(nil)
+	clients, err := newClientsWithCredential("https://fake.documents.azure.com:443/", "https://fake.openai.azure.com/", &fakeCredential{token: "test-token"}, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clients.CheckOpenAICredential(context.Background()); err != nil {
+		t.Errorf("CheckOpenAICredential = %v, want nil", err)
+	}
+
+	clients.openAICred = &fakeCredential{err: errors.New("no identity endpoint")}
+	if err := clients.CheckOpenAICredential(context.Background()); !errors.Is(err, ErrNoOpenAICredential) {
+		t.Errorf("CheckOpenAICredential = %v, want ErrNoOpenAICredential", err)
+	}
+}
+
+func TestConnectionPoolCapsConnectionsPerHost(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	release := sync.OnceFunc(func() { close(unblock) })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-unblock
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(release) // runs first, so Close does not wait on a blocked handler
+
+	o := newOptions([]Option{WithConnectionPool(PoolOptions{MaxConnsPerHost: 1})})
+	client := o.openAI.Transport.(*http.Client)
+	if o.cosmos.Transport != o.openAI.Transport {
+		t.Error("Cosmos DB and Azure OpenAI clients do not share the pool")
+	}
+
+	errs := make(chan error, 2)
+	get := func() {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		errs <- err
+	}
+
+	go get()
+	<-arrived
+	// The only connection is busy, so the second request waits for it
+	// instead of opening another.
+	go get()
+	select {
+	case <-arrived:
+		t.Fatal("second request reached the server while the first held the only connection")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release()
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(arrived) != 1 {
+		t.Errorf("%d requests reached the server after the first finished, want 1", len(arrived))
+	}
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// WithRetryTimeout bounds the total time an Azure OpenAI call may take across
+// all its attempts and the waits between them. Once d has passed, the call
+// fails with context.DeadlineExceeded instead of trying again. Zero or less
+// means no bound beyond the caller's context.
+func WithRetryTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.openAI.PerCallPolicies = append(o.openAI.PerCallPolicies, retryTimeoutPolicy{timeout: d})
+		}
+	}
+}
+
+// retryTimeoutPolicy runs the rest of the pipeline, retries included, under
+// a single deadline.
+type retryTimeoutPolicy struct {
+	timeout time.Duration
+}
+
+func (p retryTimeoutPolicy) Do(req *policy.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Raw().Context(), p.timeout)
+	defer cancel()
+	return req.WithContext(ctx).Next()
+}
+
+// attemptsKey is the context key under which retryLogPolicy stores the
+// attempt counter that attemptPolicy increments.
+type attemptsKey struct{}
+
+// retryLogPolicy is a per-call policy that logs, at debug level, how many
+// retries a call needed.
+type retryLogPolicy struct{}
+
+func (retryLogPolicy) Do(req *policy.Request) (*http.Response, error) {
+	attempts := new(int)
+	ctx := context.WithValue(req.Raw().Context(), attemptsKey{}, attempts)
+	resp, err := req.WithContext(ctx).Next()
+
+	if *attempts > 1 {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		slog.DebugContext(ctx, "Azure OpenAI call retried",
+			slog.String("path", req.Raw().URL.Path),
+			slog.Int("retries", *attempts-1),
+			slog.Int("status", status),
+			slog.Bool("failed", err != nil),
+		)
+	}
+	return resp, err
+}
+
+// attemptPolicy is a per-retry policy that counts the attempts of a call for
+// retryLogPolicy.
+type attemptPolicy struct{}
+
+func (attemptPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if n, ok := req.Raw().Context().Value(attemptsKey{}).(*int); ok {
+		*n++
+	}
+	return req.Next()
+}
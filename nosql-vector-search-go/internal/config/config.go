@@ -1,118 +1,572 @@
-package config
-
-import (
-	"fmt"
-	"os"
-	"strconv"
-	"strings"
-
-	"github.com/joho/godotenv"
-)
-
-// AlgorithmConfig holds the container name and display name for a vector algorithm.
-type AlgorithmConfig struct {
-	ContainerName string
-	AlgorithmName string
-}
-
-// AlgorithmConfigs maps algorithm identifiers to their configuration.
-var AlgorithmConfigs = map[string]AlgorithmConfig{
-	"diskann": {
-		ContainerName: "hotels_diskann",
-		AlgorithmName: "DiskANN",
-	},
-	"quantizedflat": {
-		ContainerName: "hotels_quantizedflat",
-		AlgorithmName: "QuantizedFlat",
-	},
-}
-
-// Config holds all application configuration parsed from environment variables.
-type Config struct {
-	// Azure Cosmos DB
-	CosmosEndpoint string
-	DbName         string
-	ContainerName  string
-
-	// Azure OpenAI
-	OpenAIEndpoint   string
-	OpenAIDeployment string
-
-	// Vector search
-	Algorithm        string
-	AlgorithmDisplay string
-	DistanceFunction string
-	EmbeddedField    string
-	EmbeddingDims    int
-
-	// Data
-	DataFile string
-	Query    string
-}
-
-// LoadConfig reads environment variables (with optional .env file) and returns
-// a validated Config. It fails fast on missing required values.
-func LoadConfig() (*Config, error) {
-	// Load .env file if present; ignore error (file may not exist in production)
-	_ = godotenv.Load()
-
-	algorithm := strings.TrimSpace(strings.ToLower(getEnvOrDefault("VECTOR_ALGORITHM", "diskann")))
-	algCfg, ok := AlgorithmConfigs[algorithm]
-	if !ok {
-		keys := make([]string, 0, len(AlgorithmConfigs))
-		for k := range AlgorithmConfigs {
-			keys = append(keys, k)
-		}
-		return nil, fmt.Errorf("invalid VECTOR_ALGORITHM %q; must be one of: %s", algorithm, strings.Join(keys, ", "))
-	}
-
-	dims, err := strconv.Atoi(getEnvOrDefault("EMBEDDING_DIMENSIONS", "1536"))
-	if err != nil {
-		return nil, fmt.Errorf("EMBEDDING_DIMENSIONS must be an integer: %w", err)
-	}
-
-	cfg := &Config{
-		CosmosEndpoint:   os.Getenv("AZURE_COSMOSDB_ENDPOINT"),
-		DbName:           getEnvOrDefault("AZURE_COSMOSDB_DATABASENAME", "Hotels"),
-		ContainerName:    algCfg.ContainerName,
-		OpenAIEndpoint:   os.Getenv("AZURE_OPENAI_EMBEDDING_ENDPOINT"),
-		OpenAIDeployment: getEnvOrDefault("AZURE_OPENAI_EMBEDDING_DEPLOYMENT", os.Getenv("AZURE_OPENAI_EMBEDDING_MODEL")),
-		Algorithm:        algorithm,
-		AlgorithmDisplay: algCfg.AlgorithmName,
-		DistanceFunction: getEnvOrDefault("VECTOR_DISTANCE_FUNCTION", "cosine"),
-		EmbeddedField:    getEnvOrDefault("EMBEDDED_FIELD", "DescriptionVector"),
-		EmbeddingDims:    dims,
-		DataFile:         getEnvOrDefault("DATA_FILE_WITH_VECTORS", "../data/HotelsData_toCosmosDB_Vector.json"),
-		Query:            "quintessential lodging near running trails, eateries, retail",
-	}
-
-	if err := validate(cfg); err != nil {
-		return nil, err
-	}
-	return cfg, nil
-}
-
-func validate(cfg *Config) error {
-	required := map[string]string{
-		"AZURE_COSMOSDB_ENDPOINT":           cfg.CosmosEndpoint,
-		"AZURE_OPENAI_EMBEDDING_ENDPOINT":   cfg.OpenAIEndpoint,
-		"AZURE_OPENAI_EMBEDDING_DEPLOYMENT": cfg.OpenAIDeployment,
-	}
-	var missing []string
-	for name, val := range required {
-		if val == "" {
-			missing = append(missing, name)
-		}
-	}
-	if len(missing) > 0 {
-		return fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
-	}
-	return nil
-}
-
-func getEnvOrDefault(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return fallback
-}
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// AlgorithmConfig holds the container name and display name for a vector algorithm.
+type AlgorithmConfig struct {
+	ContainerName string
+	AlgorithmName string
+}
+
+// AlgorithmConfigs maps algorithm identifiers to their configuration.
+var AlgorithmConfigs = map[string]AlgorithmConfig{
+	"diskann": {
+		ContainerName: "hotels_diskann",
+		AlgorithmName: "DiskANN",
+	},
+	"quantizedflat": {
+		ContainerName: "hotels_quantizedflat",
+		AlgorithmName: "QuantizedFlat",
+	},
+}
+
+// DistanceFunctions lists the distance functions accepted by VectorDistance.
+var DistanceFunctions = []string{"cosine", "dotproduct", "euclidean"}
+
+// SearchModes lists the accepted values of SEARCH_MODE.
+var SearchModes = []string{"vector", "text", "hybrid"}
+
+// EmbeddingCaches lists the accepted values of EMBEDDING_CACHE.
+var EmbeddingCaches = []string{"none", "memory", "disk"}
+
+// OpenAIAuthModes lists the accepted values of AZURE_OPENAI_AUTH.
+var OpenAIAuthModes = []string{"auto", "key", "entra", "managed-identity"}
+
+// ShortenableModels maps the embedding models that accept a dimensions
+// parameter to the size of their full vectors.
+var ShortenableModels = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+}
+
+// Config holds all application configuration parsed from environment variables.
+type Config struct {
+	// Azure Cosmos DB
+	CosmosEndpoint string
+	DbName         string
+	ContainerName  string
+
+	// Azure OpenAI
+	OpenAIEndpoint   string
+	OpenAIDeployment string
+	// OpenAIAuth selects how Azure OpenAI authenticates: "key" with
+	// OpenAIKey, "entra" with a Microsoft Entra token, "managed-identity"
+	// with a token for the host's managed identity only, or "auto", which
+	// uses the key when one is set and Entra otherwise.
+	// AZURE_USE_MANAGED_IDENTITY=true is the same as "managed-identity".
+	OpenAIAuth string
+	OpenAIKey  string
+	// ManagedIdentityClientID is the client ID of the user-assigned identity
+	// used with "managed-identity" (AZURE_CLIENT_ID); empty selects the
+	// system-assigned identity.
+	ManagedIdentityClientID string
+	// EmbeddingModel and EmbeddingModelVersion are recorded on every stored
+	// document, so vectors from a previous model can be found and re-embedded.
+	EmbeddingModel        string
+	EmbeddingModelVersion string
+
+	// Vector search
+	Algorithm        string
+	AlgorithmDisplay string
+	DistanceFunction string
+	EmbeddedField    string
+	EmbeddingDims    int
+	// RequestDimensions sends EmbeddingDims as the dimensions parameter of
+	// every embeddings call, so a text-embedding-3 model returns vectors of
+	// the size the container's vector policy declares.
+	RequestDimensions bool
+	MinScore          *float64 // nil when VECTOR_MIN_SCORE is not set
+	SearchListSize    int      // DiskANN searchListSizeMultiplier; 0 uses the service default
+	SearchMode        string
+	// HybridVectorWeight and HybridTextWeight weight the vector and
+	// full-text rankings in hybrid mode; query.WithHybridWeights normalizes
+	// them to sum to 1.
+	HybridVectorWeight float64
+	HybridTextWeight   float64
+	QueryTimeout       time.Duration // per-search limit; 0 means none
+	// IndexReadyTimeout is how long to wait at startup for the container's
+	// vector index to finish building; 0 skips the wait.
+	IndexReadyTimeout time.Duration
+
+	// Data
+	DataFile      string
+	Query         string
+	LoadBatchSize int // documents per transactional batch when loading, 1-100
+	// EmbeddingConcurrency is the number of embeddings calls in flight at
+	// once when the loader embeds hotels.
+	EmbeddingConcurrency int
+	// EmbeddingTokensPerMinute is the deployment's rate limit, used by the
+	// dry run to estimate how long embedding takes; 0 means unknown.
+	EmbeddingTokensPerMinute int
+	// CSVColumns maps Hotel fields (id, name, description, category, rating,
+	// tags) to CSV headers when DataFile is a .csv file. Fields not listed
+	// keep their default header.
+	CSVColumns      map[string]string
+	CSVTagSeparator string
+	// EmbeddingTemplate is the text/template that builds the text embedded
+	// for hotels without a vector; empty uses the loader's default.
+	EmbeddingTemplate string
+	// ChunkMaxTokens splits descriptions longer than this many words into
+	// separately embedded chunk documents, each overlapping the previous by
+	// ChunkOverlap words. Zero turns chunking off.
+	ChunkMaxTokens int
+	ChunkOverlap   int
+	// PrecomputedEmbeddings loads vectors from the data file as they are and
+	// never embeds hotels, so Azure OpenAI is only needed to embed the query
+	// of a vector or hybrid search.
+	PrecomputedEmbeddings bool
+	// EmbeddingCache selects where query embeddings are cached: "none",
+	// "memory" (an LRU of EmbeddingCacheSize entries), or "disk" (files in
+	// EmbeddingCacheDir, kept between runs).
+	EmbeddingCache     string
+	EmbeddingCacheSize int
+	EmbeddingCacheDir  string
+
+	// Logging
+	Debug bool
+
+	// MeasureRecall runs an exact (brute-force) search after the vector search
+	// and reports how many of the true nearest neighbors the index returned.
+	MeasureRecall bool
+
+	// ExplainResults asks the chat deployment ChatDeployment, on the same
+	// Azure OpenAI resource, why each vector search result matches.
+	ExplainResults bool
+	ChatDeployment string
+	// ChatTemperature, ChatTopP, ChatMaxTokens, ChatSeed, and ChatStop
+	// override the explanation call's generation settings; nil, zero, or
+	// empty keeps the default. ChatStop is rejected with ExplainResults,
+	// whose JSON answer a stop sequence would cut short.
+	ChatTemperature *float64
+	ChatTopP        *float64
+	ChatMaxTokens   int
+	ChatSeed        *int64
+	ChatStop        []string
+}
+
+// LoadConfig reads environment variables (with optional .env file) and returns
+// a validated Config. It fails fast on missing required values.
+func LoadConfig() (*Config, error) {
+	// Load .env file if present; ignore error (file may not exist in production)
+	_ = godotenv.Load()
+
+	algorithm := strings.TrimSpace(strings.ToLower(getEnvOrDefault("VECTOR_ALGORITHM", "diskann")))
+	algCfg, ok := AlgorithmConfigs[algorithm]
+	if !ok {
+		keys := make([]string, 0, len(AlgorithmConfigs))
+		for k := range AlgorithmConfigs {
+			keys = append(keys, k)
+		}
+		return nil, fmt.Errorf("invalid VECTOR_ALGORITHM %q; must be one of: %s", algorithm, strings.Join(keys, ", "))
+	}
+
+	distanceFunction := strings.TrimSpace(strings.ToLower(getEnvOrDefault("VECTOR_DISTANCE_FUNCTION", "cosine")))
+	if !slices.Contains(DistanceFunctions, distanceFunction) {
+		return nil, fmt.Errorf("invalid VECTOR_DISTANCE_FUNCTION %q; must be one of: %s", distanceFunction, strings.Join(DistanceFunctions, ", "))
+	}
+
+	searchMode := strings.TrimSpace(strings.ToLower(getEnvOrDefault("SEARCH_MODE", "vector")))
+	if !slices.Contains(SearchModes, searchMode) {
+		return nil, fmt.Errorf("invalid SEARCH_MODE %q; must be one of: %s", searchMode, strings.Join(SearchModes, ", "))
+	}
+
+	openAIAuth := strings.TrimSpace(strings.ToLower(getEnvOrDefault("AZURE_OPENAI_AUTH", "auto")))
+	if !slices.Contains(OpenAIAuthModes, openAIAuth) {
+		return nil, fmt.Errorf("invalid AZURE_OPENAI_AUTH %q; must be one of: %s", openAIAuth, strings.Join(OpenAIAuthModes, ", "))
+	}
+	useManagedIdentity, err := strconv.ParseBool(getEnvOrDefault("AZURE_USE_MANAGED_IDENTITY", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("AZURE_USE_MANAGED_IDENTITY must be true or false: %w", err)
+	}
+	if openAIAuth, err = resolveOpenAIAuth(openAIAuth, os.Getenv("AZURE_OPENAI_EMBEDDING_KEY"), useManagedIdentity); err != nil {
+		return nil, err
+	}
+
+	embeddingCache := strings.TrimSpace(strings.ToLower(getEnvOrDefault("EMBEDDING_CACHE", "none")))
+	if !slices.Contains(EmbeddingCaches, embeddingCache) {
+		return nil, fmt.Errorf("invalid EMBEDDING_CACHE %q; must be one of: %s", embeddingCache, strings.Join(EmbeddingCaches, ", "))
+	}
+	embeddingCacheSize, err := strconv.Atoi(getEnvOrDefault("EMBEDDING_CACHE_SIZE", "1000"))
+	if err != nil {
+		return nil, fmt.Errorf("EMBEDDING_CACHE_SIZE must be an integer: %w", err)
+	}
+	if embeddingCacheSize < 1 {
+		return nil, fmt.Errorf("EMBEDDING_CACHE_SIZE must be at least 1, got %d", embeddingCacheSize)
+	}
+
+	dims, err := strconv.Atoi(getEnvOrDefault("EMBEDDING_DIMENSIONS", "1536"))
+	if err != nil {
+		return nil, fmt.Errorf("EMBEDDING_DIMENSIONS must be an integer: %w", err)
+	}
+	if dims < 1 {
+		return nil, fmt.Errorf("EMBEDDING_DIMENSIONS must be positive, got %d", dims)
+	}
+
+	requestDims, err := strconv.ParseBool(getEnvOrDefault("EMBEDDING_REQUEST_DIMENSIONS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("EMBEDDING_REQUEST_DIMENSIONS must be true or false: %w", err)
+	}
+
+	minScore, err := optionalFloat("VECTOR_MIN_SCORE")
+	if err != nil {
+		return nil, err
+	}
+
+	searchListSize, err := strconv.Atoi(getEnvOrDefault("VECTOR_SEARCH_LIST_SIZE_MULTIPLIER", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("VECTOR_SEARCH_LIST_SIZE_MULTIPLIER must be an integer: %w", err)
+	}
+
+	hybridAlpha, err := optionalFloat("HYBRID_ALPHA")
+	if err != nil {
+		return nil, err
+	}
+	hybridVectorWeight, err := optionalFloat("HYBRID_VECTOR_WEIGHT")
+	if err != nil {
+		return nil, err
+	}
+	hybridTextWeight, err := optionalFloat("HYBRID_TEXT_WEIGHT")
+	if err != nil {
+		return nil, err
+	}
+	vectorWeight, textWeight, err := resolveHybridWeights(hybridAlpha, hybridVectorWeight, hybridTextWeight)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkMaxTokens, err := strconv.Atoi(getEnvOrDefault("CHUNK_MAX_TOKENS", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("CHUNK_MAX_TOKENS must be an integer: %w", err)
+	}
+	chunkOverlap, err := strconv.Atoi(getEnvOrDefault("CHUNK_OVERLAP", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("CHUNK_OVERLAP must be an integer: %w", err)
+	}
+	if chunkMaxTokens < 0 {
+		return nil, fmt.Errorf("CHUNK_MAX_TOKENS must not be negative, got %d", chunkMaxTokens)
+	}
+	if chunkMaxTokens > 0 && (chunkOverlap < 0 || chunkOverlap >= chunkMaxTokens) {
+		return nil, fmt.Errorf("CHUNK_OVERLAP must be between 0 and CHUNK_MAX_TOKENS-1, got %d", chunkOverlap)
+	}
+
+	csvColumns := map[string]string{}
+	if spec := os.Getenv("CSV_COLUMNS"); spec != "" {
+		for _, pair := range strings.Split(spec, ",") {
+			field, header, ok := strings.Cut(pair, "=")
+			field, header = strings.TrimSpace(field), strings.TrimSpace(header)
+			if !ok || field == "" || header == "" {
+				return nil, fmt.Errorf("CSV_COLUMNS must be a comma-separated list of field=header pairs, got %q", pair)
+			}
+			csvColumns[field] = header
+		}
+	}
+
+	queryTimeout, err := time.ParseDuration(getEnvOrDefault("QUERY_TIMEOUT", "0s"))
+	if err != nil {
+		return nil, fmt.Errorf("QUERY_TIMEOUT must be a duration such as 10s: %w", err)
+	}
+	if queryTimeout < 0 {
+		return nil, fmt.Errorf("QUERY_TIMEOUT must not be negative, got %s", queryTimeout)
+	}
+
+	indexReadyTimeout, err := time.ParseDuration(getEnvOrDefault("INDEX_READY_TIMEOUT", "0s"))
+	if err != nil {
+		return nil, fmt.Errorf("INDEX_READY_TIMEOUT must be a duration such as 5m: %w", err)
+	}
+	if indexReadyTimeout < 0 {
+		return nil, fmt.Errorf("INDEX_READY_TIMEOUT must not be negative, got %s", indexReadyTimeout)
+	}
+
+	loadBatchSize, err := strconv.Atoi(getEnvOrDefault("LOAD_BATCH_SIZE", "25"))
+	if err != nil {
+		return nil, fmt.Errorf("LOAD_BATCH_SIZE must be an integer: %w", err)
+	}
+	if loadBatchSize < 1 || loadBatchSize > 100 {
+		return nil, fmt.Errorf("LOAD_BATCH_SIZE must be between 1 and 100, got %d", loadBatchSize)
+	}
+
+	embeddingConcurrency, err := strconv.Atoi(getEnvOrDefault("EMBEDDING_CONCURRENCY", "4"))
+	if err != nil {
+		return nil, fmt.Errorf("EMBEDDING_CONCURRENCY must be an integer: %w", err)
+	}
+	if embeddingConcurrency < 1 {
+		return nil, fmt.Errorf("EMBEDDING_CONCURRENCY must be at least 1, got %d", embeddingConcurrency)
+	}
+
+	embeddingTPM, err := strconv.Atoi(getEnvOrDefault("EMBEDDING_TOKENS_PER_MINUTE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("EMBEDDING_TOKENS_PER_MINUTE must be an integer: %w", err)
+	}
+	if embeddingTPM < 0 {
+		return nil, fmt.Errorf("EMBEDDING_TOKENS_PER_MINUTE must not be negative, got %d", embeddingTPM)
+	}
+
+	debug, err := strconv.ParseBool(getEnvOrDefault("DEBUG", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("DEBUG must be true or false: %w", err)
+	}
+
+	precomputed, err := strconv.ParseBool(getEnvOrDefault("PRECOMPUTED_EMBEDDINGS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("PRECOMPUTED_EMBEDDINGS must be true or false: %w", err)
+	}
+
+	measureRecall, err := strconv.ParseBool(getEnvOrDefault("MEASURE_RECALL", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("MEASURE_RECALL must be true or false: %w", err)
+	}
+
+	explainResults, err := strconv.ParseBool(getEnvOrDefault("EXPLAIN_RESULTS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("EXPLAIN_RESULTS must be true or false: %w", err)
+	}
+
+	chatTemperature, err := optionalFloat("CHAT_TEMPERATURE")
+	if err != nil {
+		return nil, err
+	}
+	if chatTemperature != nil && (*chatTemperature < 0 || *chatTemperature > 2) {
+		return nil, fmt.Errorf("CHAT_TEMPERATURE must be between 0 and 2, got %v", *chatTemperature)
+	}
+	chatTopP, err := optionalFloat("CHAT_TOP_P")
+	if err != nil {
+		return nil, err
+	}
+	if chatTopP != nil && (*chatTopP <= 0 || *chatTopP > 1) {
+		return nil, fmt.Errorf("CHAT_TOP_P must be greater than 0 and at most 1, got %v", *chatTopP)
+	}
+	chatMaxTokens, err := strconv.Atoi(getEnvOrDefault("CHAT_MAX_TOKENS", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("CHAT_MAX_TOKENS must be an integer: %w", err)
+	}
+	if chatMaxTokens < 0 {
+		return nil, fmt.Errorf("CHAT_MAX_TOKENS must not be negative, got %d", chatMaxTokens)
+	}
+	var chatSeed *int64
+	if v := os.Getenv("CHAT_SEED"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("CHAT_SEED must be an integer: %w", err)
+		}
+		chatSeed = &seed
+	}
+	var chatStop []string
+	if v := os.Getenv("CHAT_STOP"); v != "" {
+		chatStop = strings.Split(v, "|")
+	}
+
+	cfg := &Config{
+		CosmosEndpoint:           os.Getenv("AZURE_COSMOSDB_ENDPOINT"),
+		DbName:                   getEnvOrDefault("AZURE_COSMOSDB_DATABASENAME", "Hotels"),
+		ContainerName:            getEnvOrDefault("AZURE_COSMOSDB_CONTAINERNAME", algCfg.ContainerName),
+		OpenAIEndpoint:           os.Getenv("AZURE_OPENAI_EMBEDDING_ENDPOINT"),
+		OpenAIDeployment:         getEnvOrDefault("AZURE_OPENAI_EMBEDDING_DEPLOYMENT", os.Getenv("AZURE_OPENAI_EMBEDDING_MODEL")),
+		OpenAIAuth:               openAIAuth,
+		OpenAIKey:                os.Getenv("AZURE_OPENAI_EMBEDDING_KEY"),
+		ManagedIdentityClientID:  os.Getenv("AZURE_CLIENT_ID"),
+		EmbeddingModel:           getEnvOrDefault("AZURE_OPENAI_EMBEDDING_MODEL", os.Getenv("AZURE_OPENAI_EMBEDDING_DEPLOYMENT")),
+		EmbeddingModelVersion:    os.Getenv("AZURE_OPENAI_EMBEDDING_MODEL_VERSION"),
+		Algorithm:                algorithm,
+		AlgorithmDisplay:         algCfg.AlgorithmName,
+		DistanceFunction:         distanceFunction,
+		EmbeddedField:            getEnvOrDefault("EMBEDDED_FIELD", "DescriptionVector"),
+		EmbeddingDims:            dims,
+		RequestDimensions:        requestDims,
+		MinScore:                 minScore,
+		SearchListSize:           searchListSize,
+		SearchMode:               searchMode,
+		HybridVectorWeight:       vectorWeight,
+		HybridTextWeight:         textWeight,
+		QueryTimeout:             queryTimeout,
+		IndexReadyTimeout:        indexReadyTimeout,
+		DataFile:                 getEnvOrDefault("DATA_FILE_WITH_VECTORS", "../data/HotelsData_toCosmosDB_Vector.json"),
+		Query:                    "quintessential lodging near running trails, eateries, retail",
+		LoadBatchSize:            loadBatchSize,
+		CSVColumns:               csvColumns,
+		CSVTagSeparator:          getEnvOrDefault("CSV_TAG_SEPARATOR", "|"),
+		EmbeddingTemplate:        os.Getenv("EMBEDDING_TEMPLATE"),
+		ChunkMaxTokens:           chunkMaxTokens,
+		ChunkOverlap:             chunkOverlap,
+		PrecomputedEmbeddings:    precomputed,
+		EmbeddingCache:           embeddingCache,
+		EmbeddingCacheSize:       embeddingCacheSize,
+		EmbeddingCacheDir:        getEnvOrDefault("EMBEDDING_CACHE_DIR", ".embedding-cache"),
+		EmbeddingConcurrency:     embeddingConcurrency,
+		EmbeddingTokensPerMinute: embeddingTPM,
+		Debug:                    debug,
+		MeasureRecall:            measureRecall,
+		ExplainResults:           explainResults,
+		ChatDeployment:           os.Getenv("AZURE_OPENAI_CHAT_DEPLOYMENT"),
+		ChatTemperature:          chatTemperature,
+		ChatTopP:                 chatTopP,
+		ChatMaxTokens:            chatMaxTokens,
+		ChatSeed:                 chatSeed,
+		ChatStop:                 chatStop,
+	}
+
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func validate(cfg *Config) error {
+	required := map[string]string{
+		"AZURE_COSMOSDB_ENDPOINT": cfg.CosmosEndpoint,
+	}
+	// With precomputed embeddings and a full-text search nothing is
+	// embedded, so Azure OpenAI need not be configured at all.
+	if !cfg.PrecomputedEmbeddings || cfg.SearchMode != "text" {
+		required["AZURE_OPENAI_EMBEDDING_ENDPOINT"] = cfg.OpenAIEndpoint
+		required["AZURE_OPENAI_EMBEDDING_DEPLOYMENT"] = cfg.OpenAIDeployment
+	}
+	// The chat deployment that explains results is on the same resource.
+	if cfg.ExplainResults {
+		required["AZURE_OPENAI_EMBEDDING_ENDPOINT"] = cfg.OpenAIEndpoint
+	}
+	var missing []string
+	for name, val := range required {
+		if val == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+	if cfg.OpenAIAuth == "key" && cfg.OpenAIKey == "" {
+		return fmt.Errorf("AZURE_OPENAI_AUTH=key needs AZURE_OPENAI_EMBEDDING_KEY; set it, or use AZURE_OPENAI_AUTH=entra to sign in with Microsoft Entra ID")
+	}
+	if cfg.ExplainResults && cfg.ChatDeployment == "" {
+		return fmt.Errorf("EXPLAIN_RESULTS needs AZURE_OPENAI_CHAT_DEPLOYMENT")
+	}
+	if cfg.ExplainResults && len(cfg.ChatStop) > 0 {
+		return fmt.Errorf("CHAT_STOP cannot be used with EXPLAIN_RESULTS: the explanations are a JSON object that a stop sequence would cut short")
+	}
+	if cfg.PrecomputedEmbeddings && cfg.ChunkMaxTokens > 0 {
+		return fmt.Errorf("CHUNK_MAX_TOKENS needs chunks to be embedded, so it cannot be used with PRECOMPUTED_EMBEDDINGS")
+	}
+	return nil
+}
+
+// UseOpenAIKey reports whether Azure OpenAI authenticates with OpenAIKey
+// rather than a Microsoft Entra token.
+func (cfg *Config) UseOpenAIKey() bool {
+	return cfg.OpenAIAuth == "key" || (cfg.OpenAIAuth == "auto" && cfg.OpenAIKey != "")
+}
+
+// UseManagedIdentity reports whether both Cosmos DB and Azure OpenAI
+// authenticate with the host's managed identity, selected by
+// ManagedIdentityClientID, rather than DefaultAzureCredential.
+func (cfg *Config) UseManagedIdentity() bool {
+	return cfg.OpenAIAuth == "managed-identity"
+}
+
+// resolveOpenAIAuth folds AZURE_USE_MANAGED_IDENTITY into the
+// AZURE_OPENAI_AUTH mode, rejecting combinations that ask for two different
+// credentials instead of silently picking one.
+func resolveOpenAIAuth(mode, key string, useManagedIdentity bool) (string, error) {
+	if !useManagedIdentity {
+		return mode, nil
+	}
+	switch mode {
+	case "key", "entra":
+		return "", fmt.Errorf("AZURE_USE_MANAGED_IDENTITY=true conflicts with AZURE_OPENAI_AUTH=%s; unset one of them", mode)
+	case "auto":
+		if key != "" {
+			return "", fmt.Errorf("AZURE_USE_MANAGED_IDENTITY=true conflicts with AZURE_OPENAI_EMBEDDING_KEY; " +
+				"unset the key, or set AZURE_OPENAI_AUTH=key and unset AZURE_USE_MANAGED_IDENTITY to use it")
+		}
+	}
+	return "managed-identity", nil
+}
+
+// resolveHybridWeights returns the vector and text weights of hybrid
+// search. HYBRID_VECTOR_WEIGHT and HYBRID_TEXT_WEIGHT default to 0.5 each;
+// HYBRID_ALPHA is shorthand for the pair alpha, 1-alpha and cannot be
+// combined with them.
+func resolveHybridWeights(alpha, vectorWeight, textWeight *float64) (float64, float64, error) {
+	if alpha != nil {
+		if vectorWeight != nil || textWeight != nil {
+			return 0, 0, fmt.Errorf("HYBRID_ALPHA conflicts with HYBRID_VECTOR_WEIGHT and HYBRID_TEXT_WEIGHT; set only one of them")
+		}
+		if *alpha < 0 || *alpha > 1 {
+			return 0, 0, fmt.Errorf("HYBRID_ALPHA must be between 0 and 1, got %g", *alpha)
+		}
+		return *alpha, 1 - *alpha, nil
+	}
+	v, t := 0.5, 0.5
+	if vectorWeight != nil {
+		v = *vectorWeight
+	}
+	if textWeight != nil {
+		t = *textWeight
+	}
+	if v < 0 || t < 0 {
+		return 0, 0, fmt.Errorf("HYBRID_VECTOR_WEIGHT and HYBRID_TEXT_WEIGHT must not be negative, got %g and %g", v, t)
+	}
+	if v+t == 0 {
+		return 0, 0, fmt.Errorf("HYBRID_VECTOR_WEIGHT and HYBRID_TEXT_WEIGHT must not both be 0")
+	}
+	return v, t, nil
+}
+
+// UseEmbedding switches the run to another vector field and the embedding
+// model that fills it, such as the active embedding a completed migration
+// recorded in the container, overriding EMBEDDED_FIELD,
+// EMBEDDING_DIMENSIONS, EMBEDDING_REQUEST_DIMENSIONS,
+// AZURE_OPENAI_EMBEDDING_DEPLOYMENT, AZURE_OPENAI_EMBEDDING_MODEL, and
+// AZURE_OPENAI_EMBEDDING_MODEL_VERSION.
+func (cfg *Config) UseEmbedding(field string, dims int, requestDims bool, deployment, model, version string) {
+	cfg.EmbeddedField = field
+	cfg.EmbeddingDims = dims
+	cfg.RequestDimensions = requestDims
+	cfg.OpenAIDeployment = deployment
+	cfg.EmbeddingModel = model
+	cfg.EmbeddingModelVersion = version
+}
+
+// CheckShortenable returns an error unless model accepts a dimensions
+// parameter of dims, which must not exceed the size of its full vectors.
+// LoadConfig does not call it, since the model it would check can still be
+// replaced by UseEmbedding; check the model the run ends up using.
+func CheckShortenable(model string, dims int) error {
+	full, ok := ShortenableModels[model]
+	if !ok {
+		return fmt.Errorf("model %q does not accept a dimensions parameter; use text-embedding-3-small or text-embedding-3-large, "+
+			"and set AZURE_OPENAI_EMBEDDING_MODEL when the deployment is named differently", model)
+	}
+	if dims > full {
+		return fmt.Errorf("%s returns at most %d dimensions, asked for %d", model, full, dims)
+	}
+	return nil
+}
+
+// optionalFloat parses the environment variable key as a number, returning
+// nil when it is not set.
+func optionalFloat(key string) (*float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	return &f, nil
+}
+
+func getEnvOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
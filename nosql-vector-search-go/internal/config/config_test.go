@@ -0,0 +1,66 @@
+package config
+
+import "testing"
+
+func TestResolveOpenAIAuth(t *testing.T) {
+	tests := []struct {
+		mode, key          string
+		useManagedIdentity bool
+		want               string // "" means rejected
+	}{
+		{"auto", "", false, "auto"},
+		{"key", "secret", false, "key"},
+		{"managed-identity", "", false, "managed-identity"},
+		{"auto", "", true, "managed-identity"},
+		{"managed-identity", "", true, "managed-identity"},
+		// Two credentials asked for at once.
+		{"key", "secret", true, ""},
+		{"entra", "", true, ""},
+		{"auto", "secret", true, ""},
+	}
+	for _, tt := range tests {
+		got, err := resolveOpenAIAuth(tt.mode, tt.key, tt.useManagedIdentity)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("resolveOpenAIAuth(%q, key %t, managed identity %t) = %q, want an error", tt.mode, tt.key != "", tt.useManagedIdentity, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolveOpenAIAuth(%q, key %t, managed identity %t) = %q, %v; want %q", tt.mode, tt.key != "", tt.useManagedIdentity, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveHybridWeights(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name                 string
+		alpha, vector, text  *float64
+		wantVector, wantText float64
+		wantErr              bool
+	}{
+		{name: "defaults", wantVector: 0.5, wantText: 0.5},
+		{name: "weights", vector: f(1), text: f(3), wantVector: 1, wantText: 3},
+		{name: "text only", vector: f(0), wantVector: 0, wantText: 0.5},
+		{name: "alpha", alpha: f(0.75), wantVector: 0.75, wantText: 0.25},
+		{name: "alpha out of range", alpha: f(1.5), wantErr: true},
+		{name: "alpha and weights", alpha: f(0.5), text: f(1), wantErr: true},
+		{name: "negative weight", vector: f(-1), wantErr: true},
+		{name: "both zero", vector: f(0), text: f(0), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, text, err := resolveHybridWeights(tt.alpha, tt.vector, tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("resolveHybridWeights = %g, %g; want an error", v, text)
+				}
+				return
+			}
+			if err != nil || v != tt.wantVector || text != tt.wantText {
+				t.Errorf("resolveHybridWeights = %g, %g, %v; want %g, %g", v, text, err, tt.wantVector, tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
+)
+
+// maxBatchOperations is the most operations Cosmos DB accepts in one
+// transactional batch.
+const maxBatchOperations = 100
+
+// maxBatchBytes caps the marshaled documents in one transactional batch.
+// Cosmos DB rejects batch requests over 2 MB, and the batch envelope adds a
+// little to every operation.
+const maxBatchBytes = 1_800_000
+
+// DefaultBulkChunkSize is the number of documents BulkUpsert sends per batch
+// when WithChunkSize is not used. A hotel with a 1536-dimension vector
+// marshals to about 30 KB, so 100 of them would not fit in one request.
+const DefaultBulkChunkSize = 25
+
+// FailedDoc is a hotel that BulkUpsert could not write.
+type FailedDoc struct {
+	HotelID string
+	Err     error
+}
+
+// BulkUpsertResult tracks the outcome of a BulkUpsert call.
+type BulkUpsertResult struct {
+	UpsertedCount int // documents that did not exist before
+	ModifiedCount int // existing documents that were replaced
+	SkippedCount  int // unchanged documents skipped by WithSkipUnchanged
+	Failed        []FailedDoc
+	RequestCharge float64
+}
+
+// BulkOption configures BulkUpsert.
+type BulkOption func(*bulkOptions)
+
+type bulkOptions struct {
+	chunkSize     int
+	skipUnchanged bool
+	model         ModelInfo
+	progress      ProgressFunc
+	shared        *Progress
+}
+
+// ModelInfo identifies the embedding model that produced the vectors being
+// written.
+type ModelInfo struct {
+	Model   string // for example "text-embedding-3-small"
+	Version string // the model version, such as "1"; optional
+}
+
+// WithChunkSize sets how many documents BulkUpsert sends per transactional
+// batch, between 1 and 100. Batches are split further when their documents
+// would exceed the request size limit.
+func WithChunkSize(n int) BulkOption {
+	return func(o *bulkOptions) {
+		o.chunkSize = n
+	}
+}
+
+// WithSkipUnchanged makes BulkUpsert skip hotels whose stored ContentHash
+// matches the incoming document, saving the write. It costs one query per
+// chunk to read the stored hashes.
+func WithSkipUnchanged() BulkOption {
+	return func(o *bulkOptions) {
+		o.skipUnchanged = true
+	}
+}
+
+// WithModelInfo records the embedding model on every document BulkUpsert
+// writes, in EmbeddingModel and EmbeddingVersion. FindStaleDocuments then
+// finds the documents embedded by another model.
+func WithModelInfo(info ModelInfo) BulkOption {
+	return func(o *bulkOptions) {
+		o.model = info
+	}
+}
+
+// WithProgress makes BulkUpsert call fn after every batch. Use
+// ConsoleProgress for a single updating line on the terminal.
+func WithProgress(fn ProgressFunc) BulkOption {
+	return func(o *bulkOptions) {
+		o.progress = fn
+	}
+}
+
+// WithSharedProgress makes BulkUpsert add the documents it handles to p, so
+// progress and the ETA run across several calls. It takes precedence over
+// WithProgress. BulkUpsert never finishes p; the caller does.
+func WithSharedProgress(p *Progress) BulkOption {
+	return func(o *bulkOptions) {
+		o.shared = p
+	}
+}
+
+// BulkUpsert creates or replaces hotel documents in chunks, sending each chunk
+// as one transactional batch instead of one request per document. Batches are
+// possible because every document shares the sample's partition key.
+//
+// Vectors are stored in embeddedField. Every hotel is checked with Validate
+// against the container's vector policy for that field before anything is
+// written. Invalid hotels are not written; the valid ones still are. The
+// invalid hotels are reported in Failed, and the returned error is then a
+// ValidationErrors listing all of them, alongside the result.
+//
+// A transactional batch is all-or-nothing, so when a batch fails its
+// documents are retried one at a time; only the documents that still fail
+// are reported in Failed. Any other error is returned for invalid options,
+// when the policy cannot be read, or when stored hashes cannot be read.
+func BulkUpsert(ctx context.Context, container *azcosmos.ContainerClient, hotels []Hotel, embeddedField string, opts ...BulkOption) (*BulkUpsertResult, error) {
+	o := bulkOptions{chunkSize: DefaultBulkChunkSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.chunkSize < 1 || o.chunkSize > maxBatchOperations {
+		return nil, fmt.Errorf("chunk size must be between 1 and %d, got %d", maxBatchOperations, o.chunkSize)
+	}
+
+	dims, err := query.PolicyDimensions(ctx, container, embeddedField)
+	if err != nil {
+		return nil, err
+	}
+	valid, invalid := splitValid(hotels, dims)
+
+	result := &BulkUpsertResult{}
+	for _, verr := range invalid {
+		result.Failed = append(result.Failed, FailedDoc{HotelID: verr.HotelID, Err: verr})
+	}
+	if len(invalid) > 0 {
+		fmt.Printf("Skipping %d invalid items\n", len(invalid))
+	}
+	fmt.Printf("Upserting %d items in batches of %d...\n", len(valid), o.chunkSize)
+
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	progress := o.shared
+	if progress == nil {
+		progress = NewProgress(len(hotels), o.progress)
+	}
+	progress.Add(len(invalid))
+
+	for start := 0; start < len(valid); start += o.chunkSize {
+		chunk := valid[start:min(start+o.chunkSize, len(valid))]
+
+		var stored map[string]string
+		if o.skipUnchanged {
+			chunkIDs := make([]string, len(chunk))
+			for i, h := range chunk {
+				chunkIDs[i] = h.HotelID
+			}
+			var charge float64
+			var err error
+			stored, charge, err = storedContentHashes(ctx, container, chunkIDs)
+			result.RequestCharge += charge
+			if err != nil {
+				return result, err
+			}
+		}
+
+		bodies, ids := changedBodies(chunk, stored, embeddedField, o.model, result)
+		for _, r := range sizedBatches(bodies, maxBatchBytes) {
+			upsertBatch(ctx, container, pk, bodies[r[0]:r[1]], ids[r[0]:r[1]], result)
+		}
+		// Every hotel of the chunk is done, whether it was written, skipped,
+		// or failed.
+		progress.Add(len(chunk))
+	}
+	if o.shared == nil {
+		progress.Finish()
+	}
+
+	fmt.Printf("\nUpsert complete — created: %d, replaced: %d, unchanged: %d, failed: %d\n",
+		result.UpsertedCount, result.ModifiedCount, result.SkippedCount, len(result.Failed))
+	fmt.Printf("Upsert Request Charge: %.2f RUs\n\n", result.RequestCharge)
+	if len(invalid) > 0 {
+		return result, invalid
+	}
+	return result, nil
+}
+
+// splitValid validates every hotel against dims and returns the valid ones,
+// in order, and a ValidationError for each invalid one.
+func splitValid(hotels []Hotel, dims int) ([]Hotel, ValidationErrors) {
+	valid := make([]Hotel, 0, len(hotels))
+	var invalid ValidationErrors
+	for _, h := range hotels {
+		var verr *ValidationError
+		if errors.As(h.Validate(dims), &verr) {
+			invalid = append(invalid, verr)
+			continue
+		}
+		valid = append(valid, h)
+	}
+	return valid, invalid
+}
+
+// changedBodies marshals the hotels of a chunk and returns the bodies and
+// hotel IDs of those whose content hash differs from stored; a nil stored
+// keeps every hotel. Skipped and unmarshalable hotels are recorded in
+// result.
+func changedBodies(chunk []Hotel, stored map[string]string, embeddedField string, model ModelInfo, result *BulkUpsertResult) ([][]byte, []string) {
+	bodies := make([][]byte, 0, len(chunk))
+	ids := make([]string, 0, len(chunk))
+	for _, h := range chunk {
+		body, hash, err := marshalWithContentHash(h, embeddedField, model)
+		if err != nil {
+			result.Failed = append(result.Failed, FailedDoc{HotelID: h.HotelID, Err: fmt.Errorf("failed to marshal: %w", err)})
+			continue
+		}
+		if stored[h.HotelID] == hash {
+			result.SkippedCount++
+			continue
+		}
+		bodies = append(bodies, body)
+		ids = append(ids, h.HotelID)
+	}
+	return bodies, ids
+}
+
+// upsertBatch writes bodies as one transactional batch, falling back to one
+// upsert per document when the batch fails, and records the outcome in
+// result.
+func upsertBatch(ctx context.Context, container *azcosmos.ContainerClient, pk azcosmos.PartitionKey, bodies [][]byte, ids []string, result *BulkUpsertResult) {
+	batch := container.NewTransactionalBatch(pk)
+	for _, body := range bodies {
+		batch.UpsertItem(body, nil)
+	}
+
+	resp, err := container.ExecuteTransactionalBatch(ctx, batch, nil)
+	if err == nil {
+		result.RequestCharge += float64(resp.RequestCharge)
+	}
+	if err == nil && resp.Success {
+		for _, r := range resp.OperationResults {
+			result.countStatus(r.StatusCode)
+		}
+		slog.DebugContext(ctx, "batch upserted",
+			slog.Int("items", len(bodies)),
+			slog.Float64("requestCharge", float64(resp.RequestCharge)),
+		)
+		return
+	}
+
+	slog.WarnContext(ctx, "batch failed; upserting items individually",
+		slog.Int("items", len(bodies)),
+		slog.Any("error", err),
+	)
+	for i, body := range bodies {
+		itemResp, err := container.UpsertItem(ctx, pk, body, nil)
+		if err != nil {
+			result.Failed = append(result.Failed, FailedDoc{HotelID: ids[i], Err: err})
+			slog.ErrorContext(ctx, "upsert failed", slog.String("hotelID", ids[i]), slog.Any("error", err))
+			continue
+		}
+		result.RequestCharge += float64(itemResp.RequestCharge)
+		result.countStatus(int32(itemResp.RawResponse.StatusCode))
+	}
+}
+
+// sizedBatches splits bodies into consecutive [start, end) ranges whose
+// total size is at most maxBytes. A body larger than maxBytes on its own gets
+// a range to itself, so the service reports it rather than the others.
+func sizedBatches(bodies [][]byte, maxBytes int) [][2]int {
+	var ranges [][2]int
+	start, size := 0, 0
+	for i, body := range bodies {
+		if i > start && size+len(body) > maxBytes {
+			ranges = append(ranges, [2]int{start, i})
+			start, size = i, 0
+		}
+		size += len(body)
+	}
+	if start < len(bodies) {
+		ranges = append(ranges, [2]int{start, len(bodies)})
+	}
+	return ranges
+}
+
+// countStatus records a successful upsert: 201 Created for a new document,
+// 200 OK for a replaced one.
+func (r *BulkUpsertResult) countStatus(statusCode int32) {
+	if statusCode == http.StatusCreated {
+		r.UpsertedCount++
+	} else {
+		r.ModifiedCount++
+	}
+}
+
+// marshalWithContentHash returns the document body for a hotel with a
+// ContentHash field: the SHA-256 of the document without that field. Map keys
+// are marshaled in sorted order, so equal hotels hash equally. A non-empty
+// model is recorded in the document, and so changes the hash.
+func marshalWithContentHash(h Hotel, embeddedField string, model ModelInfo) ([]byte, string, error) {
+	doc := newDocument(h, embeddedField)
+	if model.Model != "" {
+		doc["EmbeddingModel"] = model.Model
+		doc["EmbeddingVersion"] = model.Version
+	}
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(payload)
+	hash := hex.EncodeToString(sum[:])
+
+	doc["ContentHash"] = hash
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, hash, nil
+}
+
+// storedContentHashes returns the ContentHash of each listed hotel that
+// exists, keyed by hotel ID, and the request charge.
+func storedContentHashes(ctx context.Context, container *azcosmos.ContainerClient, hotelIDs []string) (map[string]string, float64, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager(
+		"SELECT c.id, c.ContentHash FROM c WHERE ARRAY_CONTAINS(@ids, c.id)", pk,
+		&azcosmos.QueryOptions{QueryParameters: []azcosmos.QueryParameter{{Name: "@ids", Value: hotelIDs}}},
+	)
+
+	hashes := make(map[string]string, len(hotelIDs))
+	var charge float64
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, charge, fmt.Errorf("failed to read content hashes: %w", query.ClassifyError(err))
+		}
+		charge += float64(resp.RequestCharge)
+		for _, raw := range resp.Items {
+			var row struct {
+				ID          string `json:"id"`
+				ContentHash string `json:"ContentHash"`
+			}
+			if err := json.Unmarshal(raw, &row); err != nil {
+				return nil, charge, fmt.Errorf("failed to parse content hash: %w", err)
+			}
+			hashes[row.ID] = row.ContentHash
+		}
+	}
+	return hashes, charge, nil
+}
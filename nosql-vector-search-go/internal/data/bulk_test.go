@@ -0,0 +1,145 @@
+package data
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestSizedBatches(t *testing.T) {
+	body := func(n int) []byte { return make([]byte, n) }
+
+	tests := []struct {
+		name   string
+		sizes  []int
+		limit  int
+		ranges [][2]int
+	}{
+		{"empty", nil, 10, nil},
+		{"all fit", []int{3, 3, 3}, 10, [][2]int{{0, 3}}},
+		{"exactly at the limit", []int{5, 5, 5}, 10, [][2]int{{0, 2}, {2, 3}}},
+		{"split when over", []int{4, 4, 4, 4}, 10, [][2]int{{0, 2}, {2, 4}}},
+		{"oversized body alone", []int{2, 20, 2}, 10, [][2]int{{0, 1}, {1, 2}, {2, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies := make([][]byte, len(tt.sizes))
+			for i, n := range tt.sizes {
+				bodies[i] = body(n)
+			}
+			if got := sizedBatches(bodies, tt.limit); !slices.Equal(got, tt.ranges) {
+				t.Errorf("sizedBatches = %v, want %v", got, tt.ranges)
+			}
+		})
+	}
+}
+
+// TestDefaultChunkFitsBatchLimit checks that a default-sized chunk of hotels
+// with full 3072-dimension vectors is split into batches under the request
+// size limit.
+func TestDefaultChunkFitsBatchLimit(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	bodies := make([][]byte, maxBatchOperations)
+	for i := range bodies {
+		vector := make([]float32, 3072)
+		for j := range vector {
+			vector[j] = rng.Float32()*2 - 1
+		}
+		h := Hotel{HotelID: fmt.Sprint(i), HotelName: "Hotel", Description: "A hotel.", DescriptionVector: vector}
+		body, _, err := marshalWithContentHash(h, "DescriptionVector", ModelInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[i] = body
+	}
+
+	ranges := sizedBatches(bodies, maxBatchBytes)
+	if len(ranges) < 2 {
+		t.Fatalf("%d large hotels went in %d batch", len(bodies), len(ranges))
+	}
+	for _, r := range ranges {
+		size := 0
+		for _, body := range bodies[r[0]:r[1]] {
+			size += len(body)
+		}
+		if size > maxBatchBytes {
+			t.Errorf("batch %v is %d bytes, over the %d limit", r, size, maxBatchBytes)
+		}
+	}
+	if last := ranges[len(ranges)-1]; last[1] != len(bodies) {
+		t.Errorf("batches end at %d, want %d", last[1], len(bodies))
+	}
+
+	defaultChunk := 0
+	for _, body := range bodies[:DefaultBulkChunkSize] {
+		defaultChunk += len(body)
+	}
+	if defaultChunk > maxBatchBytes {
+		t.Errorf("a default chunk of %d large hotels is %d bytes, over the %d limit", DefaultBulkChunkSize, defaultChunk, maxBatchBytes)
+	}
+}
+
+// benchmarkHotels returns n hotels with 1536-dimension vectors.
+func benchmarkHotels(n int) []Hotel {
+	rng := rand.New(rand.NewPCG(3, 4))
+	hotels := make([]Hotel, n)
+	for i := range hotels {
+		vector := make([]float32, 1536)
+		for j := range vector {
+			vector[j] = rng.Float32()*2 - 1
+		}
+		hotels[i] = Hotel{
+			HotelID:           fmt.Sprint(i),
+			HotelName:         fmt.Sprintf("Hotel %d", i),
+			Description:       "A quiet hotel near the harbor with a rooftop terrace.",
+			Rating:            4,
+			DescriptionVector: vector,
+		}
+	}
+	return hotels
+}
+
+// BenchmarkBulkUpsertSkipUnchanged compares the client-side work of
+// BulkUpsert for 10,000 hotels when every hotel is written and when every
+// stored hash matches. Hashing costs a second marshal per hotel either way;
+// what skipping saves is the writes, reported as writes/op and
+// written-MB/op, which in the service cost far more than the hashing.
+func BenchmarkBulkUpsertSkipUnchanged(b *testing.B) {
+	hotels := benchmarkHotels(10_000)
+	allStored := make(map[string]string, len(hotels))
+	for _, h := range hotels {
+		_, hash, err := marshalWithContentHash(h, "DescriptionVector", ModelInfo{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		allStored[h.HotelID] = hash
+	}
+
+	for _, bm := range []struct {
+		name   string
+		stored map[string]string
+	}{
+		{"write all", nil},
+		{"skip unchanged", allStored},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			var writes, written int
+			for range b.N {
+				writes, written = 0, 0
+				result := &BulkUpsertResult{}
+				for start := 0; start < len(hotels); start += DefaultBulkChunkSize {
+					chunk := hotels[start:min(start+DefaultBulkChunkSize, len(hotels))]
+					bodies, _ := changedBodies(chunk, bm.stored, "DescriptionVector", ModelInfo{}, result)
+					writes += len(bodies)
+					for _, body := range bodies {
+						written += len(body)
+					}
+				}
+			}
+			b.ReportMetric(float64(writes), "writes/op")
+			b.ReportMetric(float64(written)/1e6, "written-MB/op")
+		})
+	}
+}
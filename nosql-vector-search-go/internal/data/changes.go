@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
+)
+
+// Change operation types reported by WatchChanges.
+const (
+	OperationUpsert     = "upsert"
+	OperationSoftDelete = "softDelete"
+)
+
+// ChangeEvent is a hotel document that was created or modified.
+type ChangeEvent struct {
+	// OperationType is OperationUpsert for a created or updated hotel, or
+	// OperationSoftDelete for one marked deleted by SoftDeleteHotel.
+	// Cosmos DB does not distinguish inserts from updates.
+	OperationType string
+	DocumentID    string
+	Hotel         *Hotel
+	// DescriptionChanged reports whether the embedded text (the description,
+	// or the stored EmbeddingTemplate rendered for the hotel) no longer
+	// matches the hash its stored vector was computed from, meaning the hotel
+	// needs to be re-embedded (see UpsertHotel). It is true for documents
+	// written without a hash.
+	DescriptionChanged bool
+}
+
+// changedHotel is a stored hotel with its last-modified timestamp and the
+// ETag of that version.
+type changedHotel struct {
+	storedHotel
+	Timestamp int64  `json:"_ts"`
+	ETag      string `json:"_etag"`
+}
+
+// WatchChanges reports hotels created or modified from now on, polling the
+// container every interval for documents with a newer _ts. Callers typically
+// re-embed the events with DescriptionChanged set.
+//
+// Hard deletes (DeleteHotel) leave no document behind and are not reported;
+// use SoftDeleteHotel when other processes need to see deletions. Errors are
+// sent on the error channel and polling continues. Both channels are closed
+// once ctx is done.
+func WatchChanges(ctx context.Context, container *azcosmos.ContainerClient, interval time.Duration) (<-chan ChangeEvent, <-chan error) {
+	events := make(chan ChangeEvent)
+	errs := make(chan error)
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+
+		tracker := newChangeTracker(time.Now().Unix())
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			changes, err := readChangesSince(ctx, container, tracker.since)
+			if err != nil {
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			for _, event := range tracker.events(changes) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// changeTracker turns the documents each poll reads into events. _ts has
+// one-second resolution, so each poll re-reads the last second and the
+// tracker skips the versions it already reported for it. Versions are told
+// apart by ETag, so a document written twice within a second is reported
+// twice.
+type changeTracker struct {
+	since int64
+	seen  map[string]bool // ETags reported with _ts == since
+}
+
+func newChangeTracker(since int64) *changeTracker {
+	return &changeTracker{since: since, seen: make(map[string]bool)}
+}
+
+// events returns the events for changes, which are ordered by _ts, leaving
+// out versions already reported, and moves the tracker to the newest _ts.
+func (t *changeTracker) events(changes []changedHotel) []ChangeEvent {
+	var events []ChangeEvent
+	for _, c := range changes {
+		if c.Timestamp < t.since || (c.Timestamp == t.since && t.seen[c.ETag]) {
+			continue
+		}
+		if c.Timestamp > t.since {
+			t.since = c.Timestamp
+			clear(t.seen)
+		}
+		t.seen[c.ETag] = true
+
+		event := ChangeEvent{
+			OperationType:      OperationUpsert,
+			DocumentID:         c.ID,
+			Hotel:              &c.Hotel,
+			DescriptionChanged: !c.embeddingCurrent(),
+		}
+		if c.IsDeleted {
+			event.OperationType = OperationSoftDelete
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// readChangesSince returns the hotels modified at or after the given Unix
+// time, oldest first.
+func readChangesSince(ctx context.Context, container *azcosmos.ContainerClient, since int64) ([]changedHotel, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager("SELECT * FROM c WHERE c._ts >= @since AND NOT IS_DEFINED(c.ParentId) ORDER BY c._ts", pk, &azcosmos.QueryOptions{
+		QueryParameters: []azcosmos.QueryParameter{{Name: "@since", Value: since}},
+	})
+
+	var changes []changedHotel
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read changes: %w", query.ClassifyError(err))
+		}
+		for _, raw := range resp.Items {
+			var c changedHotel
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return nil, fmt.Errorf("failed to parse changed document: %w", err)
+			}
+			c.HotelID = c.ID
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChangeTrackerReportsEachVersionOnce(t *testing.T) {
+	changed := func(id, etag string, ts int64, deleted bool) changedHotel {
+		h := Hotel{HotelID: id, HotelName: "Inn", Description: "Quiet rooms", IsDeleted: deleted}
+		return changedHotel{
+			storedHotel: storedHotel{Hotel: h, ID: id, DescriptionHash: DescriptionHash("Quiet rooms")},
+			Timestamp:   ts,
+			ETag:        etag,
+		}
+	}
+	describe := func(events []ChangeEvent) []string {
+		var out []string
+		for _, e := range events {
+			out = append(out, e.DocumentID+" "+e.OperationType)
+		}
+		return out
+	}
+
+	tracker := newChangeTracker(100)
+	polls := []struct {
+		changes []changedHotel
+		want    []string
+	}{
+		{[]changedHotel{changed("old", "e0", 99, false), changed("a", "e1", 100, false), changed("b", "e2", 101, false)},
+			[]string{"a upsert", "b upsert"}},
+		// Second 101 is read again: b was already reported, c is new.
+		{[]changedHotel{changed("b", "e2", 101, false), changed("c", "e3", 101, false)},
+			[]string{"c upsert"}},
+		// b is soft-deleted within the same second it was written: a new
+		// version, so it is reported again.
+		{[]changedHotel{changed("b", "e2", 101, false), changed("c", "e3", 101, false), changed("b", "e4", 101, true)},
+			[]string{"b softDelete"}},
+		{[]changedHotel{changed("b", "e4", 101, true), changed("c", "e3", 101, false)}, nil},
+		{[]changedHotel{changed("a", "e5", 102, false)}, []string{"a upsert"}},
+	}
+	for i, p := range polls {
+		events := tracker.events(p.changes)
+		if got := describe(events); !slices.Equal(got, p.want) {
+			t.Errorf("poll %d events = %q, want %q", i, got, p.want)
+		}
+		for _, e := range events {
+			if e.DescriptionChanged {
+				t.Errorf("poll %d: %s reported with DescriptionChanged although its hash matches", i, e.DocumentID)
+			}
+		}
+	}
+	if tracker.since != 102 {
+		t.Errorf("since = %d, want 102", tracker.since)
+	}
+}
+
+func TestIntegrationWatchChanges(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	container := newIntegrationContainer(t, ctx)
+
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	events, errs := WatchChanges(watchCtx, container, 250*time.Millisecond)
+
+	next := func(want string) ChangeEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.OperationType != want || e.DocumentID != "1" {
+				t.Fatalf("event = %s %s, want %s 1", e.OperationType, e.DocumentID, want)
+			}
+			return e
+		case err := <-errs:
+			t.Fatalf("WatchChanges error: %v", err)
+		case <-time.After(30 * time.Second):
+			t.Fatalf("no %s event within 30s", want)
+		}
+		return ChangeEvent{}
+	}
+
+	// Written without an embed function, so no hash: the vector's source
+	// text is unknown and the hotel needs embedding.
+	hotel := Hotel{HotelID: "1", HotelName: "Smoke Test Inn", Description: "Quiet rooms", Rating: 4, DescriptionVector: []float32{0.25, 0.5}}
+	if _, err := UpsertHotel(ctx, container, hotel, "contentVector", nil, nil, ModelInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(OperationUpsert); !e.DescriptionChanged || e.Hotel == nil || e.Hotel.HotelName != hotel.HotelName {
+		t.Errorf("upsert event = %+v, want the hotel with DescriptionChanged", e)
+	}
+
+	if err := SoftDeleteHotel(ctx, container, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(OperationSoftDelete); e.Hotel == nil || !e.Hotel.IsDeleted {
+		t.Errorf("soft delete event = %+v, want the hotel marked deleted", e)
+	}
+
+	stopWatching()
+	for events != nil || errs != nil {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("channels not closed after the context was cancelled")
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
+)
+
+// ChunkDescription splits text into passages of at most maxTokens tokens,
+// each starting overlap tokens before the previous one ended so a sentence
+// cut at a boundary still appears whole in one passage. Tokens are estimated
+// as whitespace-separated words. Text that fits in one passage is returned
+// as is.
+func ChunkDescription(text string, maxTokens, overlap int) ([]string, error) {
+	if maxTokens < 1 {
+		return nil, fmt.Errorf("chunk size must be at least 1 token, got %d", maxTokens)
+	}
+	if overlap < 0 || overlap >= maxTokens {
+		return nil, fmt.Errorf("chunk overlap must be between 0 and %d tokens, got %d", maxTokens-1, overlap)
+	}
+
+	words := strings.Fields(text)
+	if len(words) <= maxTokens {
+		return []string{text}, nil
+	}
+
+	var chunks []string
+	for start := 0; ; start += maxTokens - overlap {
+		end := min(start+maxTokens, len(words))
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			return chunks, nil
+		}
+	}
+}
+
+// ChunkResult tracks the outcome of an UpsertChunks call.
+type ChunkResult struct {
+	ChunkCount    int // chunk documents the hotels now have
+	EmbeddedCount int // chunks that were (or would be) new or changed and embedded
+	DeletedCount  int // leftover chunks of descriptions that got shorter
+	// EstimatedTokens is the estimated size of the embedded chunk texts; see
+	// EstimateTokens.
+	EstimatedTokens int
+	RequestCharge   float64
+	// DryRun is set when nothing was embedded or written because the result
+	// comes from PlanChunks. DeletedCount is then always 0.
+	DryRun bool
+}
+
+// descriptionChunk is one passage of a hotel's description.
+type descriptionChunk struct {
+	parent int // index of the hotel in the slice passed to UpsertChunks
+	index  int
+	text   string
+}
+
+// chunkPlan is what UpsertChunks has to do for a set of hotels.
+type chunkPlan struct {
+	parents []string // IDs of every hotel, chunked or not
+	ids     []string // IDs of every chunk document the hotels should have
+	changed []descriptionChunk
+}
+
+// UpsertChunks stores one document per chunk of each hotel description
+// longer than maxTokens, so a passage deep in a long description can match a
+// query on its own. Each chunk document copies the hotel's fields, so search
+// filters still apply, and adds ParentId (the hotel ID), ChunkIndex,
+// ChunkText, and the chunk's own vector in embeddedField. A non-empty model
+// is recorded in EmbeddingModel and EmbeddingVersion, as WithModelInfo does
+// for hotels. Search with query.WithCollapseChunks to fold chunk hits back
+// into their hotel.
+//
+// Chunks whose stored DescriptionHash matches their text and whose stored
+// EmbeddingModel matches model are not embedded or written again, unless
+// force is set. Chunks left over from a longer version of a description are
+// deleted. Hotels that fit in one chunk get no chunk documents.
+func UpsertChunks(ctx context.Context, container *azcosmos.ContainerClient, hotels []Hotel, embeddedField string, embed BatchEmbedFunc, maxTokens, overlap int, model ModelInfo, force bool) (*ChunkResult, error) {
+	result := &ChunkResult{}
+	if err := query.ValidateFieldName(embeddedField); err != nil {
+		return result, err
+	}
+
+	plan, err := planChunks(ctx, container, hotels, embeddedField, maxTokens, overlap, model, force, result)
+	if err != nil {
+		return result, err
+	}
+	changed := plan.changed
+	result.EmbeddedCount = 0 // counted as the chunks are embedded
+
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	for start := 0; start < len(changed); start += maxBatchOperations {
+		batch := changed[start:min(start+maxBatchOperations, len(changed))]
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.text
+		}
+		vectors, err := embed(ctx, texts)
+		if err != nil {
+			return result, fmt.Errorf("failed to embed description chunks: %w", err)
+		}
+		result.EmbeddedCount += len(batch)
+
+		bodies := make([][]byte, len(batch))
+		for i, c := range batch {
+			parent := hotels[c.parent]
+			body, err := json.Marshal(chunkDocument(parent, embeddedField, c.index, c.text, vectors[i], model))
+			if err != nil {
+				return result, fmt.Errorf("failed to marshal chunk %d of hotel %s: %w", c.index, parent.HotelID, err)
+			}
+			bodies[i] = body
+		}
+		// Every chunk copies its hotel's fields and carries a vector, so 100
+		// of them can exceed the request size limit.
+		for _, r := range sizedBatches(bodies, maxBatchBytes) {
+			tb := container.NewTransactionalBatch(pk)
+			for _, body := range bodies[r[0]:r[1]] {
+				tb.UpsertItem(body, nil)
+			}
+			resp, err := container.ExecuteTransactionalBatch(ctx, tb, nil)
+			if err != nil {
+				return result, fmt.Errorf("failed to upsert description chunks: %w", query.ClassifyError(err))
+			}
+			result.RequestCharge += float64(resp.RequestCharge)
+			if !resp.Success {
+				return result, fmt.Errorf("failed to upsert description chunks: batch was rolled back")
+			}
+		}
+	}
+
+	deleted, charge, err := deleteStaleChunks(ctx, container, plan.parents, plan.ids)
+	result.DeletedCount = deleted
+	result.RequestCharge += charge
+	if err != nil {
+		return result, err
+	}
+
+	fmt.Printf("Chunks: %d for long descriptions, embedded %d new/changed, deleted %d stale\n",
+		result.ChunkCount, result.EmbeddedCount, result.DeletedCount)
+	return result, nil
+}
+
+// PlanChunks works out what UpsertChunks would do, reading the stored chunk
+// hashes but calling no embedding model and writing nothing, and returns the
+// result with DryRun set. Stale chunks that UpsertChunks would delete are not
+// counted.
+func PlanChunks(ctx context.Context, container *azcosmos.ContainerClient, hotels []Hotel, embeddedField string, maxTokens, overlap int, model ModelInfo, force bool) (*ChunkResult, error) {
+	result := &ChunkResult{DryRun: true}
+	if err := query.ValidateFieldName(embeddedField); err != nil {
+		return result, err
+	}
+	_, err := planChunks(ctx, container, hotels, embeddedField, maxTokens, overlap, model, force, result)
+	return result, err
+}
+
+// planChunks splits the hotels' descriptions and selects the chunks that
+// must be embedded, recording the counts, estimated tokens, and request
+// charge in result.
+func planChunks(ctx context.Context, container *azcosmos.ContainerClient, hotels []Hotel, embeddedField string, maxTokens, overlap int, model ModelInfo, force bool, result *ChunkResult) (*chunkPlan, error) {
+	plan := &chunkPlan{}
+	var chunks []descriptionChunk
+	for i, h := range hotels {
+		texts, err := ChunkDescription(h.Description, maxTokens, overlap)
+		if err != nil {
+			return nil, err
+		}
+		plan.parents = append(plan.parents, h.HotelID)
+		if len(texts) == 1 {
+			continue
+		}
+		for j, text := range texts {
+			chunks = append(chunks, descriptionChunk{parent: i, index: j, text: text})
+			plan.ids = append(plan.ids, chunkID(h.HotelID, j))
+		}
+	}
+	result.ChunkCount = len(chunks)
+
+	if force {
+		plan.changed = chunks
+	} else {
+		for start := 0; start < len(chunks); start += maxBatchOperations {
+			end := min(start+maxBatchOperations, len(chunks))
+			stored, charge, err := storedVectors(ctx, container, embeddedField, plan.ids[start:end])
+			result.RequestCharge += charge
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range chunks[start:end] {
+				s, ok := stored[chunkID(hotels[c.parent].HotelID, c.index)]
+				if !ok || s.DescriptionHash != DescriptionHash(c.text) || len(s.Vector) == 0 ||
+					(model.Model != "" && s.EmbeddingModel != model.Model) {
+					plan.changed = append(plan.changed, c)
+				}
+			}
+		}
+	}
+
+	for _, c := range plan.changed {
+		result.EstimatedTokens += EstimateTokens(c.text)
+	}
+	result.EmbeddedCount = len(plan.changed)
+	return plan, nil
+}
+
+// chunkDocument builds the document for chunk index of a hotel's
+// description: the hotel's own document with the chunk's id, ParentId,
+// ChunkIndex, ChunkText, hash, and vector.
+func chunkDocument(parent Hotel, embeddedField string, index int, text string, vector []float32, model ModelInfo) map[string]interface{} {
+	doc := newDocument(parent, embeddedField)
+	doc["id"] = chunkID(parent.HotelID, index)
+	doc["ParentId"] = parent.HotelID
+	doc["ChunkIndex"] = index
+	doc["ChunkText"] = text
+	doc["DescriptionHash"] = DescriptionHash(text)
+	doc[embeddedField] = vector
+	delete(doc, "EmbeddingTemplate")
+	if model.Model != "" {
+		doc["EmbeddingModel"] = model.Model
+		doc["EmbeddingVersion"] = model.Version
+	}
+	return doc
+}
+
+// chunkID returns the document id of a hotel's chunk. Cosmos DB ids may not
+// contain '/', '\', '?' or '#', so the parts are joined with underscores.
+func chunkID(hotelID string, index int) string {
+	return fmt.Sprintf("%s_chunk_%d", hotelID, index)
+}
+
+// deleteStaleChunks deletes the chunk documents of the listed hotels that are
+// not in keep.
+func deleteStaleChunks(ctx context.Context, container *azcosmos.ContainerClient, parents, keep []string) (int, float64, error) {
+	stale, charge, err := findChunks(ctx, container, parents, keep)
+	if err != nil {
+		return 0, charge, err
+	}
+
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	for i, id := range stale {
+		resp, err := container.DeleteItem(ctx, pk, id, nil)
+		if err != nil && !isNotFound(err) {
+			return i, charge, fmt.Errorf("failed to delete stale chunk %s: %w", id, query.ClassifyError(err))
+		}
+		if err == nil {
+			charge += float64(resp.RequestCharge)
+		}
+	}
+	return len(stale), charge, nil
+}
+
+// findChunks returns the ids of the chunk documents of the listed hotels,
+// leaving out those in exclude.
+func findChunks(ctx context.Context, container *azcosmos.ContainerClient, parents, exclude []string) ([]string, float64, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager(
+		"SELECT VALUE c.id FROM c WHERE ARRAY_CONTAINS(@parents, c.ParentId) AND NOT ARRAY_CONTAINS(@exclude, c.id)", pk,
+		&azcosmos.QueryOptions{QueryParameters: []azcosmos.QueryParameter{
+			{Name: "@parents", Value: parents},
+			{Name: "@exclude", Value: exclude},
+		}},
+	)
+
+	var ids []string
+	var charge float64
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, charge, fmt.Errorf("failed to find chunks: %w", query.ClassifyError(err))
+		}
+		charge += float64(resp.RequestCharge)
+		for _, raw := range resp.Items {
+			var id string
+			if err := json.Unmarshal(raw, &id); err != nil {
+				return nil, charge, fmt.Errorf("failed to parse chunk id: %w", err)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, charge, nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChunkDescription(t *testing.T) {
+	chunks, err := ChunkDescription("a b c d e f g", 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(chunks, "|"), "a b c|c d e|e f g"; got != want {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+
+	short := "fits  in one"
+	if chunks, err := ChunkDescription(short, 3, 0); err != nil || len(chunks) != 1 || chunks[0] != short {
+		t.Errorf("ChunkDescription(%q) = %q, %v; want the text unchanged", short, chunks, err)
+	}
+
+	for _, tc := range []struct{ maxTokens, overlap int }{{0, 0}, {3, 3}, {3, -1}} {
+		if _, err := ChunkDescription("a b c d", tc.maxTokens, tc.overlap); err == nil {
+			t.Errorf("ChunkDescription accepted maxTokens %d, overlap %d", tc.maxTokens, tc.overlap)
+		}
+	}
+}
+
+func TestChunkIDIsValidCosmosID(t *testing.T) {
+	id := chunkID("42", 3)
+	if id != "42_chunk_3" {
+		t.Errorf("chunkID = %q, want 42_chunk_3", id)
+	}
+	if strings.ContainsAny(id, `/\?#`) {
+		t.Errorf("chunkID %q contains a character Cosmos DB does not allow in ids", id)
+	}
+}
+
+func TestChunkDocument(t *testing.T) {
+	parent := Hotel{HotelID: "42", HotelName: "Long Hotel", Description: "one two three", DescriptionVector: []float32{1}, embeddingTemplate: "{{.Description}}"}
+	doc := chunkDocument(parent, "contentVector", 1, "two three", []float32{0.5}, ModelInfo{Model: "text-embedding-3-small", Version: "1"})
+
+	want := map[string]any{
+		"id":               "42_chunk_1",
+		"ParentId":         "42",
+		"ChunkIndex":       1,
+		"ChunkText":        "two three",
+		"HotelName":        "Long Hotel",
+		"DescriptionHash":  DescriptionHash("two three"),
+		"EmbeddingModel":   "text-embedding-3-small",
+		"EmbeddingVersion": "1",
+	}
+	for key, value := range want {
+		if doc[key] != value {
+			t.Errorf("%s = %v, want %v", key, doc[key], value)
+		}
+	}
+	if v, _ := doc["contentVector"].([]float32); len(v) != 1 || v[0] != 0.5 {
+		t.Errorf("contentVector = %v, want the chunk's vector", doc["contentVector"])
+	}
+	if _, ok := doc["EmbeddingTemplate"]; ok {
+		t.Error("chunk document has the hotel's EmbeddingTemplate")
+	}
+
+	doc = chunkDocument(parent, "contentVector", 0, "one two", []float32{0.5}, ModelInfo{})
+	if _, ok := doc["EmbeddingModel"]; ok {
+		t.Error("chunk document has EmbeddingModel without a model")
+	}
+}
+
+func TestChunkDocumentsSplitByBytes(t *testing.T) {
+	// A full batch of chunks copies 100 hotels with 3072-dimension vectors,
+	// several times the request size limit.
+	vector := make([]float32, 3072)
+	for i := range vector {
+		vector[i] = -0.012345678
+	}
+	parent := benchmarkHotels(1)[0]
+	bodies := make([][]byte, maxBatchOperations)
+	for i := range bodies {
+		body, err := json.Marshal(chunkDocument(parent, "DescriptionVector", i, "text", vector, ModelInfo{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[i] = body
+	}
+	ranges := sizedBatches(bodies, maxBatchBytes)
+	if len(ranges) < 2 {
+		t.Fatalf("%d chunk documents went in one batch", len(bodies))
+	}
+	for _, r := range ranges {
+		size := 0
+		for _, body := range bodies[r[0]:r[1]] {
+			size += len(body)
+		}
+		if size > maxBatchBytes {
+			t.Errorf("batch %v is %d bytes, over the %d limit", r, size, maxBatchBytes)
+		}
+	}
+}
+
+func TestPlanChunksCountsTokens(t *testing.T) {
+	hotels := []Hotel{
+		{HotelID: "1", Description: "one two three four five six"},
+		{HotelID: "2", Description: "short"},
+	}
+	// With force set, nothing is read from the container.
+	result, err := PlanChunks(t.Context(), nil, hotels, "contentVector", 3, 0, ModelInfo{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.DryRun || result.ChunkCount != 2 || result.EmbeddedCount != 2 {
+		t.Errorf("result = %+v, want a dry run with 2 chunks to embed", result)
+	}
+	if want := 2 * EstimateTokens("one two three"); result.EstimatedTokens != want {
+		t.Errorf("EstimatedTokens = %d, want %d", result.EstimatedTokens, want)
+	}
+
+	if _, err := PlanChunks(t.Context(), nil, hotels, "bad field", 3, 0, ModelInfo{}, true); err == nil {
+		t.Error("PlanChunks accepted an invalid field name")
+	}
+}
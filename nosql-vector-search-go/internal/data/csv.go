@@ -0,0 +1,175 @@
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSVMapping names the CSV header of each column LoadHotelsCSV reads. Headers
+// are matched case-insensitively. ID, Name, and Description must be present
+// in the file; Category, Rating, and Tags are optional and left empty when the
+// file lacks them.
+type CSVMapping struct {
+	ID          string
+	Name        string
+	Description string
+	Category    string
+	Rating      string
+	Tags        string
+	// TagSeparator splits the Tags column into individual tags.
+	TagSeparator string
+}
+
+// DefaultCSVMapping matches a CSV export with the same column names as the
+// JSON data file.
+var DefaultCSVMapping = CSVMapping{
+	ID:           "HotelId",
+	Name:         "HotelName",
+	Description:  "Description",
+	Category:     "Category",
+	Rating:       "Rating",
+	Tags:         "Tags",
+	TagSeparator: "|",
+}
+
+// Set maps one Hotel field to a CSV header. field is one of id, name,
+// description, category, rating, or tags, in any case.
+func (m *CSVMapping) Set(field, header string) error {
+	switch strings.ToLower(field) {
+	case "id":
+		m.ID = header
+	case "name":
+		m.Name = header
+	case "description":
+		m.Description = header
+	case "category":
+		m.Category = header
+	case "rating":
+		m.Rating = header
+	case "tags":
+		m.Tags = header
+	default:
+		return fmt.Errorf("unknown CSV column field %q; expected id, name, description, category, rating, or tags", field)
+	}
+	return nil
+}
+
+// utf8BOM is the byte order mark some spreadsheet tools write at the start of
+// a UTF-8 CSV export.
+const utf8BOM = "\ufeff"
+
+// LoadHotelsCSV reads hotels from a CSV file with a header row. The hotels
+// have no DescriptionVector; they are embedded on the way into the container
+// like any other hotel without one.
+func LoadHotelsCSV(filePath string, mapping CSVMapping) ([]Hotel, error) {
+	fmt.Printf("Reading CSV file from %s\n", filePath)
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	hotels, err := ParseHotelsCSV(f, mapping)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CSV in file %q: %w", filePath, err)
+	}
+
+	fmt.Printf("Loaded %d hotel documents\n", len(hotels))
+	return hotels, nil
+}
+
+// ParseHotelsCSV reads hotels from CSV data with a header row. Quoted fields
+// may contain commas, quotes, and line breaks, and a leading byte order mark
+// is ignored. Rows with no ID are an error, as are ratings that are not
+// numbers.
+func ParseHotelsCSV(r io.Reader, mapping CSVMapping) ([]Hotel, error) {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(len(utf8BOM)); err == nil && string(bom) == utf8BOM {
+		br.Discard(len(utf8BOM))
+	}
+
+	reader := csv.NewReader(br)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("missing header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	column := func(name string) int {
+		if i, ok := positions[strings.ToLower(name)]; ok && name != "" {
+			return i
+		}
+		return -1
+	}
+
+	idCol, nameCol, descCol := column(mapping.ID), column(mapping.Name), column(mapping.Description)
+	var missing []string
+	for _, c := range []struct {
+		name string
+		pos  int
+	}{{mapping.ID, idCol}, {mapping.Name, nameCol}, {mapping.Description, descCol}} {
+		if c.pos < 0 {
+			missing = append(missing, strconv.Quote(c.name))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required columns: %s", strings.Join(missing, ", "))
+	}
+	categoryCol, ratingCol, tagsCol := column(mapping.Category), column(mapping.Rating), column(mapping.Tags)
+
+	var hotels []Hotel
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		h := Hotel{
+			HotelID:     strings.TrimSpace(record[idCol]),
+			HotelName:   record[nameCol],
+			Description: record[descCol],
+		}
+		if h.HotelID == "" {
+			return nil, fmt.Errorf("line %d: empty %s", line, mapping.ID)
+		}
+		if categoryCol >= 0 {
+			h.Category = record[categoryCol]
+		}
+		if ratingCol >= 0 {
+			if v := strings.TrimSpace(record[ratingCol]); v != "" {
+				h.Rating, err = strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s %q is not a number", line, mapping.Rating, v)
+				}
+			}
+		}
+		if tagsCol >= 0 && mapping.TagSeparator != "" {
+			for _, tag := range strings.Split(record[tagsCol], mapping.TagSeparator) {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					h.Tags = append(h.Tags, tag)
+				}
+			}
+		}
+		hotels = append(hotels, h)
+	}
+	return hotels, nil
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// csvGolden is what a golden file records for one CSV input: the parsed
+// hotels, or the parse error.
+type csvGolden struct {
+	Hotels []csvGoldenHotel `json:",omitempty"`
+	Error  string           `json:",omitempty"`
+}
+
+// csvGoldenHotel holds the Hotel fields ParseHotelsCSV sets.
+type csvGoldenHotel struct {
+	HotelID     string
+	HotelName   string
+	Description string
+	Category    string
+	Rating      float64
+	Tags        []string
+}
+
+// TestParseHotelsCSVGolden parses every testdata/csv/*.csv file with
+// DefaultCSVMapping and compares the result with the .golden file beside it.
+// Run with -update to rewrite the golden files.
+func TestParseHotelsCSVGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "csv", "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no CSV test inputs found")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".csv")
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var got csvGolden
+			hotels, err := ParseHotelsCSV(f, DefaultCSVMapping)
+			if err != nil {
+				got.Error = err.Error()
+			}
+			for _, h := range hotels {
+				got.Hotels = append(got.Hotels, csvGoldenHotel{
+					HotelID:     h.HotelID,
+					HotelName:   h.HotelName,
+					Description: h.Description,
+					Category:    h.Category,
+					Rating:      h.Rating,
+					Tags:        h.Tags,
+				})
+			}
+			gotJSON, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON = append(gotJSON, '\n')
+
+			golden := strings.TrimSuffix(input, ".csv") + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(golden, gotJSON, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			// Checkouts that convert line endings may give the golden file CRLFs.
+			want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+			if !bytes.Equal(gotJSON, want) {
+				t.Errorf("ParseHotelsCSV(%s) =\n%s\nwant\n%s", input, gotJSON, want)
+			}
+		})
+	}
+}
+
+func TestParseHotelsCSVCustomMapping(t *testing.T) {
+	mapping := DefaultCSVMapping
+	for field, header := range map[string]string{"name": "Hotel Name", "description": "Summary", "tags": "Labels"} {
+		if err := mapping.Set(field, header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mapping.TagSeparator = ";"
+
+	hotels, err := ParseHotelsCSV(strings.NewReader("HotelId,Hotel Name,Summary,Labels\n7,Mapped,Uses custom headers,a; b\n"), mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hotels) != 1 {
+		t.Fatalf("got %d hotels, want 1", len(hotels))
+	}
+	h := hotels[0]
+	if h.HotelName != "Mapped" || h.Description != "Uses custom headers" || strings.Join(h.Tags, ",") != "a,b" {
+		t.Errorf("got %+v", h)
+	}
+
+	if err := mapping.Set("address", "Street"); err == nil {
+		t.Error("Set accepted an unknown field")
+	}
+}
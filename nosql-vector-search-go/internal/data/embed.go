@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
+)
+
+// BatchEmbedFunc returns one embedding per text, in input order.
+type BatchEmbedFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+// EmbedResult tracks the outcome of an EmbedChanged call, or what a call
+// would do when it comes from PlanEmbeddings.
+type EmbedResult struct {
+	EmbeddedCount int // hotels whose text was (or would be) sent to the embedding model
+	SkippedCount  int // hotels that kept their own or the stored vector
+	SkippedIDs    []string
+	// EstimatedTokens is the estimated size of the embedded texts; see
+	// EstimateTokens.
+	EstimatedTokens int
+	RequestCharge   float64
+	// DryRun is set when nothing was embedded because the result comes from
+	// PlanEmbeddings.
+	DryRun bool
+}
+
+// EmbedChanged fills in DescriptionVector for hotels that need a new
+// embedding and returns the number embedded and skipped.
+//
+// The embedded text is built by tmpl, or is the description alone when tmpl
+// is nil. A hotel that already carries a vector keeps it. Otherwise, if the
+// stored document's DescriptionHash matches the hash of the text, the vector
+// stored in embeddedField is reused; only new hotels and hotels whose text changed, including
+// through a change of template, are embedded. With force set, every hotel is
+// embedded again.
+//
+// Stored hashes are read with one query per chunk of 100 hotels, which costs
+// far less than regenerating the embeddings on every run.
+func EmbedChanged(ctx context.Context, container *azcosmos.ContainerClient, hotels []Hotel, embeddedField string, embed BatchEmbedFunc, tmpl *EmbeddingTemplate, force bool) (*EmbedResult, error) {
+	result, changed, texts, err := planEmbeddings(ctx, container, hotels, embeddedField, tmpl, force)
+	if err != nil {
+		return result, err
+	}
+
+	if len(changed) > 0 {
+		batch := make([]string, len(changed))
+		for j, i := range changed {
+			batch[j] = texts[i]
+		}
+		vectors, err := embed(ctx, batch)
+		if err != nil {
+			return result, fmt.Errorf("failed to embed hotel descriptions: %w", err)
+		}
+		for j, i := range changed {
+			hotels[i].DescriptionVector = vectors[j]
+		}
+	}
+
+	fmt.Printf("Embeddings: skipped %d unchanged, embedded %d new/changed\n", result.SkippedCount, result.EmbeddedCount)
+	return result, nil
+}
+
+// PlanEmbeddings works out what EmbedChanged would do, reading the stored
+// hashes but calling no embedding model, and returns the result with DryRun
+// set. Hotels whose stored vector can be reused get it, as with EmbedChanged;
+// no other hotel is changed.
+func PlanEmbeddings(ctx context.Context, container *azcosmos.ContainerClient, hotels []Hotel, embeddedField string, tmpl *EmbeddingTemplate, force bool) (*EmbedResult, error) {
+	result, _, _, err := planEmbeddings(ctx, container, hotels, embeddedField, tmpl, force)
+	result.DryRun = true
+	return result, err
+}
+
+// planEmbeddings selects the hotels EmbedChanged must embed, returning their
+// indexes and the text to embed for each. Hotels whose stored vector is
+// current get it copied in.
+func planEmbeddings(ctx context.Context, container *azcosmos.ContainerClient, hotels []Hotel, embeddedField string, tmpl *EmbeddingTemplate, force bool) (*EmbedResult, []int, map[int]string, error) {
+	result := &EmbedResult{}
+	if err := query.ValidateFieldName(embeddedField); err != nil {
+		return result, nil, nil, err
+	}
+	skip := func(h Hotel) {
+		result.SkippedCount++
+		result.SkippedIDs = append(result.SkippedIDs, h.HotelID)
+	}
+
+	var pending []int
+	texts := make(map[int]string)
+	for i, h := range hotels {
+		if !force && len(h.DescriptionVector) > 0 {
+			skip(h)
+			continue
+		}
+		text, err := embeddingText(tmpl, h)
+		if err != nil {
+			return result, nil, nil, fmt.Errorf("hotel %s: %w", h.HotelID, err)
+		}
+		texts[i] = text
+		pending = append(pending, i)
+
+		// Recorded on the document so a later load can tell whether the
+		// vector is still current.
+		hotels[i].embeddingHash = DescriptionHash(text)
+		if tmpl != nil {
+			hotels[i].embeddingTemplate = tmpl.Source()
+		}
+	}
+
+	var changed []int
+	if force {
+		changed = pending
+	} else {
+		for start := 0; start < len(pending); start += maxBatchOperations {
+			chunk := pending[start:min(start+maxBatchOperations, len(pending))]
+			ids := make([]string, len(chunk))
+			for j, i := range chunk {
+				ids[j] = hotels[i].HotelID
+			}
+
+			stored, charge, err := storedVectors(ctx, container, embeddedField, ids)
+			result.RequestCharge += charge
+			if err != nil {
+				return result, nil, nil, err
+			}
+			for _, i := range chunk {
+				s, ok := stored[hotels[i].HotelID]
+				if ok && s.DescriptionHash == hotels[i].embeddingHash && len(s.Vector) > 0 {
+					hotels[i].DescriptionVector = s.Vector
+					skip(hotels[i])
+					continue
+				}
+				changed = append(changed, i)
+			}
+		}
+	}
+
+	for _, i := range changed {
+		result.EstimatedTokens += EstimateTokens(texts[i])
+	}
+	result.EmbeddedCount = len(changed)
+	return result, changed, texts, nil
+}
+
+// EstimateTokens roughly estimates how many tokens text costs to embed, at
+// four tokens for every three words, without loading a tokenizer.
+func EstimateTokens(text string) int {
+	return (len(strings.Fields(text))*4 + 2) / 3
+}
+
+// storedVector is the part of a stored hotel that EmbedChanged reuses.
+type storedVector struct {
+	ID              string    `json:"id"`
+	DescriptionHash string    `json:"DescriptionHash"`
+	EmbeddingModel  string    `json:"EmbeddingModel"`
+	Vector          []float32 `json:"Vector"`
+}
+
+// storedVectors returns the DescriptionHash, EmbeddingModel, and the vector
+// in embeddedField of each listed hotel that exists in the container, keyed by hotel ID.
+// embeddedField must already be validated with query.ValidateFieldName.
+func storedVectors(ctx context.Context, container *azcosmos.ContainerClient, embeddedField string, hotelIDs []string) (map[string]storedVector, float64, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager(
+		"SELECT c.id, c.DescriptionHash, c.EmbeddingModel, c."+embeddedField+" AS Vector FROM c WHERE ARRAY_CONTAINS(@ids, c.id)", pk,
+		&azcosmos.QueryOptions{QueryParameters: []azcosmos.QueryParameter{{Name: "@ids", Value: hotelIDs}}},
+	)
+
+	vectors := make(map[string]storedVector, len(hotelIDs))
+	var charge float64
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, charge, fmt.Errorf("failed to read stored embeddings: %w", query.ClassifyError(err))
+		}
+		charge += float64(resp.RequestCharge)
+		for _, raw := range resp.Items {
+			var row storedVector
+			if err := json.Unmarshal(raw, &row); err != nil {
+				return nil, charge, fmt.Errorf("failed to parse stored embedding: %w", err)
+			}
+			vectors[row.ID] = row
+		}
+	}
+	return vectors, charge, nil
+}
@@ -0,0 +1,293 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
+)
+
+// ErrHotelNotFound is returned when no document exists for a hotel ID.
+var ErrHotelNotFound = errors.New("hotel not found")
+
+// EmbedFunc produces an embedding for the given text. It lets UpsertHotel
+// regenerate a hotel's vector without depending on a specific client.
+type EmbedFunc func(ctx context.Context, text string) ([]float32, error)
+
+// storedHotel is a hotel as stored in the container. The document "id" holds
+// the real hotel ID because HotelId is overwritten with the partition key.
+type storedHotel struct {
+	Hotel
+	ID              string `json:"id"`
+	DescriptionHash string `json:"DescriptionHash"`
+	// EmbeddingTemplate is the template the vector was embedded through, or
+	// empty when it was embedded from the description alone.
+	EmbeddingTemplate string `json:"EmbeddingTemplate"`
+}
+
+// embeddingCurrent reports whether the stored DescriptionHash still matches
+// the text the hotel's vector would be embedded from. A template that no
+// longer parses counts as out of date.
+func (s *storedHotel) embeddingCurrent() bool {
+	var tmpl *EmbeddingTemplate
+	if s.EmbeddingTemplate != "" {
+		var err error
+		if tmpl, err = NewEmbeddingTemplate(s.EmbeddingTemplate); err != nil {
+			return false
+		}
+	}
+	text, err := embeddingText(tmpl, s.Hotel)
+	return err == nil && s.DescriptionHash == DescriptionHash(text)
+}
+
+// DescriptionHash returns the SHA-256 hash of the text that is embedded for a
+// hotel, used to tell whether a stored vector is still current.
+func DescriptionHash(description string) string {
+	sum := sha256.Sum256([]byte(description))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetHotel reads a single hotel by ID, with the vector stored in
+// embeddedField as its DescriptionVector. Returns ErrHotelNotFound if the
+// document does not exist.
+func GetHotel(ctx context.Context, container *azcosmos.ContainerClient, hotelID, embeddedField string) (*Hotel, error) {
+	stored, err := readHotel(ctx, container, hotelID, embeddedField)
+	if err != nil {
+		return nil, err
+	}
+	return &stored.Hotel, nil
+}
+
+// UpsertHotel creates or replaces a hotel document, storing its vector in
+// embeddedField. When embed is non-nil the vector is embedded from the text
+// tmpl renders for the hotel, or from the description alone when tmpl is nil,
+// like EmbedChanged. The stored vector is reused when the stored
+// DescriptionHash matches that text; otherwise the text is embedded again.
+// When embed is nil the hotel's own DescriptionVector is stored without a
+// DescriptionHash. The document gets a ContentHash, and a non-empty model is
+// recorded in EmbeddingModel and EmbeddingVersion, as BulkUpsert does with
+// WithModelInfo, so FindStaleDocuments and WithSkipUnchanged treat it like a
+// loaded hotel.
+//
+// When the description changed, the hotel's description chunks (see
+// UpsertChunks) are deleted first, since their text no longer matches; call
+// UpsertChunks to split the new description. Returns the request charge.
+func UpsertHotel(ctx context.Context, container *azcosmos.ContainerClient, hotel Hotel, embeddedField string, embed EmbedFunc, tmpl *EmbeddingTemplate, model ModelInfo) (float64, error) {
+	existing, err := readHotel(ctx, container, hotel.HotelID, embeddedField)
+	if err != nil && !errors.Is(err, ErrHotelNotFound) {
+		return 0, err
+	}
+
+	if embed != nil {
+		text, err := embeddingText(tmpl, hotel)
+		if err != nil {
+			return 0, fmt.Errorf("hotel %s: %w", hotel.HotelID, err)
+		}
+		hash := DescriptionHash(text)
+
+		if existing != nil && existing.DescriptionHash == hash && len(existing.DescriptionVector) > 0 {
+			hotel.DescriptionVector = existing.DescriptionVector
+		} else {
+			vector, err := embed(ctx, text)
+			if err != nil {
+				return 0, fmt.Errorf("failed to embed description for hotel %s: %w", hotel.HotelID, err)
+			}
+			hotel.DescriptionVector = vector
+		}
+
+		hotel.embeddingHash = hash
+		if tmpl != nil {
+			hotel.embeddingTemplate = tmpl.Source()
+		}
+	}
+
+	if err := query.CheckDimensions(ctx, container, embeddedField, len(hotel.DescriptionVector)); err != nil {
+		return 0, fmt.Errorf("hotel %s: %w", hotel.HotelID, err)
+	}
+
+	body, _, err := marshalWithContentHash(hotel, embeddedField, model)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal hotel %s: %w", hotel.HotelID, err)
+	}
+
+	// Chunks go first, so if deleting them fails the stored description
+	// still differs and calling UpsertHotel again retries.
+	var charge float64
+	if existing != nil && existing.Description != hotel.Description {
+		_, deleteCharge, err := deleteStaleChunks(ctx, container, []string{hotel.HotelID}, []string{})
+		charge += deleteCharge
+		if err != nil {
+			return charge, fmt.Errorf("failed to upsert hotel %s: %w", hotel.HotelID, err)
+		}
+	}
+
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	resp, err := container.UpsertItem(ctx, pk, body, nil)
+	if err != nil {
+		return charge, fmt.Errorf("failed to upsert hotel %s: %w", hotel.HotelID, query.ClassifyError(err))
+	}
+	return charge + float64(resp.RequestCharge), nil
+}
+
+// HotelExists reports whether a document exists for the hotel ID. It
+// reads only the id and content hash, so it is cheaper than GetHotel.
+func HotelExists(ctx context.Context, container *azcosmos.ContainerClient, hotelID string) (bool, error) {
+	hashes, _, err := storedContentHashes(ctx, container, []string{hotelID})
+	if err != nil {
+		return false, err
+	}
+	_, ok := hashes[hotelID]
+	return ok, nil
+}
+
+// GetContentHash returns the ContentHash that BulkUpsert stored with a hotel,
+// or an empty string if the hotel was written without one. Returns
+// ErrHotelNotFound if the document does not exist.
+func GetContentHash(ctx context.Context, container *azcosmos.ContainerClient, hotelID string) (string, error) {
+	hashes, _, err := storedContentHashes(ctx, container, []string{hotelID})
+	if err != nil {
+		return "", err
+	}
+	hash, ok := hashes[hotelID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrHotelNotFound, hotelID)
+	}
+	return hash, nil
+}
+
+// DeleteHotel removes a hotel document and its description chunks (see
+// UpsertChunks). Returns ErrHotelNotFound if the hotel document does not
+// exist.
+func DeleteHotel(ctx context.Context, container *azcosmos.ContainerClient, hotelID string) error {
+	// Chunks go first, so if deleting them fails the hotel is still there
+	// and DeleteHotel can simply be called again.
+	if _, _, err := deleteStaleChunks(ctx, container, []string{hotelID}, []string{}); err != nil {
+		return fmt.Errorf("failed to delete hotel %s: %w", hotelID, err)
+	}
+
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	if _, err := container.DeleteItem(ctx, pk, hotelID, nil); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %s", ErrHotelNotFound, hotelID)
+		}
+		return fmt.Errorf("failed to delete hotel %s: %w", hotelID, query.ClassifyError(err))
+	}
+	return nil
+}
+
+// SoftDeleteHotel marks a hotel and its description chunks as deleted without
+// removing them: IsDeleted is set to true and DeletedAt to the current UTC
+// time. Searches still return the hotel unless they use
+// query.WithExcludeDeleted. Returns ErrHotelNotFound if the hotel document
+// does not exist.
+func SoftDeleteHotel(ctx context.Context, container *azcosmos.ContainerClient, hotelID string) error {
+	var ops azcosmos.PatchOperations
+	ops.AppendSet("/IsDeleted", true)
+	ops.AppendSet("/DeletedAt", time.Now().UTC().Format(time.RFC3339))
+
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	if _, err := container.PatchItem(ctx, pk, hotelID, ops, nil); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %s", ErrHotelNotFound, hotelID)
+		}
+		return fmt.Errorf("failed to soft-delete hotel %s: %w", hotelID, query.ClassifyError(err))
+	}
+
+	chunks, _, err := findChunks(ctx, container, []string{hotelID}, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to soft-delete hotel %s: %w", hotelID, err)
+	}
+	for _, id := range chunks {
+		if _, err := container.PatchItem(ctx, pk, id, ops, nil); err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to soft-delete chunk %s: %w", id, query.ClassifyError(err))
+		}
+	}
+	return nil
+}
+
+// FindStaleDocuments returns the IDs of hotel and description chunk
+// documents whose vectors were not embedded by currentModel: documents
+// written with a different EmbeddingModel, or before the model was recorded
+// (see WithModelInfo and UpsertChunks). Re-embed them, for example by
+// running the loader with -force, after switching embedding models.
+func FindStaleDocuments(ctx context.Context, container *azcosmos.ContainerClient, currentModel string) ([]string, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager(
+		"SELECT VALUE c.id FROM c WHERE NOT IS_DEFINED(c.EmbeddingModel) OR c.EmbeddingModel != @model", pk,
+		&azcosmos.QueryOptions{QueryParameters: []azcosmos.QueryParameter{{Name: "@model", Value: currentModel}}},
+	)
+
+	var ids []string
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find stale documents: %w", query.ClassifyError(err))
+		}
+		for _, raw := range resp.Items {
+			var id string
+			if err := json.Unmarshal(raw, &id); err != nil {
+				return nil, fmt.Errorf("failed to parse document id: %w", err)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// readHotel reads a stored hotel, taking its DescriptionVector from
+// embeddedField.
+func readHotel(ctx context.Context, container *azcosmos.ContainerClient, hotelID, embeddedField string) (*storedHotel, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	resp, err := container.ReadItem(ctx, pk, hotelID, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrHotelNotFound, hotelID)
+		}
+		return nil, fmt.Errorf("failed to read hotel %s: %w", hotelID, query.ClassifyError(err))
+	}
+
+	var stored storedHotel
+	if err := json.Unmarshal(resp.Value, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse hotel %s: %w", hotelID, err)
+	}
+	stored.HotelID = stored.ID
+	if stored.DescriptionVector, err = storedVectorField(resp.Value, embeddedField); err != nil {
+		return nil, fmt.Errorf("failed to parse hotel %s: %w", hotelID, err)
+	}
+	return &stored, nil
+}
+
+// storedVectorField decodes the vector in a document's embeddedField, or
+// returns nil when the document has none.
+func storedVectorField(doc []byte, embeddedField string) ([]float32, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+	raw, ok := fields[embeddedField]
+	if !ok {
+		return nil, nil
+	}
+	var vector []float32
+	if err := json.Unmarshal(raw, &vector); err != nil {
+		return nil, fmt.Errorf("%s: %w", embeddedField, err)
+	}
+	return vector, nil
+}
+
+// isNotFound reports whether err means the addressed document does not
+// exist. A 404 because the database or container is missing is not one.
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound &&
+		!errors.Is(query.ClassifyError(err), query.ErrContainerNotFound)
+}
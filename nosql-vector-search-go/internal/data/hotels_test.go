@@ -0,0 +1,213 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// readError returns the error the SDK reports when reading a document fails
+// with status and, if not empty, an x-ms-substatus.
+func readError(status int, substatus string) error {
+	header := http.Header{}
+	if substatus != "" {
+		header.Set("x-ms-substatus", substatus)
+	}
+	req := &http.Request{Method: http.MethodGet, URL: &url.URL{Scheme: "https", Host: "example.azure.com", Path: "/dbs/Hotels/colls/hotels/docs/1"}, Header: http.Header{}}
+	return runtime.NewResponseError(&http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(`{"code":"NotFound"}`)),
+		Request:    req,
+	})
+}
+
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"document missing", readError(http.StatusNotFound, ""), true},
+		{"wrapped", fmt.Errorf("read: %w", readError(http.StatusNotFound, "")), true},
+		{"container missing", readError(http.StatusNotFound, "1003"), false},
+		{"server error", readError(http.StatusInternalServerError, ""), false},
+		{"not a response", errors.New("connection reset"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isNotFound(tc.err); got != tc.want {
+				t.Errorf("isNotFound = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStoredHotelEmbeddingCurrent(t *testing.T) {
+	h := Hotel{HotelName: "Inn", Description: "Quiet rooms"}
+	tests := []struct {
+		name   string
+		stored storedHotel
+		want   bool
+	}{
+		{"description", storedHotel{Hotel: h, DescriptionHash: DescriptionHash("Quiet rooms")}, true},
+		{"template", storedHotel{Hotel: h, DescriptionHash: DescriptionHash("Inn: Quiet rooms"), EmbeddingTemplate: "{{.HotelName}}: {{.Description}}"}, true},
+		{"changed", storedHotel{Hotel: h, DescriptionHash: DescriptionHash("Loud rooms")}, false},
+		{"no hash", storedHotel{Hotel: h}, false},
+		{"broken template", storedHotel{Hotel: h, DescriptionHash: DescriptionHash("Quiet rooms"), EmbeddingTemplate: "{{.Missing"}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.stored.embeddingCurrent(); got != tc.want {
+				t.Errorf("embeddingCurrent = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// newIntegrationContainer creates an empty container with the sample's
+// partition key path in the database AZURE_COSMOSDB_DATABASENAME ("Hotels"
+// if unset) of the account in AZURE_COSMOSDB_ENDPOINT, and deletes it when
+// the test ends. The test is skipped when no endpoint is configured.
+func newIntegrationContainer(t *testing.T, ctx context.Context) *azcosmos.ContainerClient {
+	t.Helper()
+	endpoint := os.Getenv("AZURE_COSMOSDB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AZURE_COSMOSDB_ENDPOINT is not set; skipping integration test")
+	}
+	dbName := os.Getenv("AZURE_COSMOSDB_DATABASENAME")
+	if dbName == "" {
+		dbName = "Hotels"
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := azcosmos.NewClient(endpoint, cred, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := client.NewDatabase(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := fmt.Sprintf("smoke-%d", time.Now().UnixNano())
+	if _, err := database.CreateContainer(ctx, azcosmos.ContainerProperties{
+		ID:                     id,
+		PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{Paths: []string{"/HotelId"}},
+	}, nil); err != nil {
+		t.Fatalf("failed to create container %q: %v", id, err)
+	}
+	container, err := database.NewContainer(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := container.Delete(context.Background(), nil); err != nil {
+			t.Errorf("failed to delete container %q: %v", id, err)
+		}
+	})
+	return container
+}
+
+func TestIntegrationGetHotel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	container := newIntegrationContainer(t, ctx)
+
+	want := Hotel{HotelID: "1", HotelName: "Smoke Test Inn", Description: "Quiet rooms", Rating: 4, Tags: []string{"pool"}, DescriptionVector: []float32{0.25, 0.5}}
+	body, err := json.Marshal(newDocument(want, "contentVector"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	if _, err := container.CreateItem(ctx, pk, body, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetHotel(ctx, container, "1", "contentVector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.HotelID != want.HotelID || got.HotelName != want.HotelName || got.Rating != want.Rating ||
+		!slices.Equal(got.Tags, want.Tags) || !slices.Equal(got.DescriptionVector, want.DescriptionVector) {
+		t.Errorf("GetHotel = %+v, want %+v", got, want)
+	}
+
+	if _, err := GetHotel(ctx, container, "missing", "contentVector"); !errors.Is(err, ErrHotelNotFound) {
+		t.Errorf("GetHotel(missing) error = %v, want ErrHotelNotFound", err)
+	}
+	if err := DeleteHotel(ctx, container, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetHotel(ctx, container, "1", "contentVector"); !errors.Is(err, ErrHotelNotFound) {
+		t.Errorf("GetHotel after DeleteHotel error = %v, want ErrHotelNotFound", err)
+	}
+}
+
+func TestIntegrationUpsertHotel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	container := newIntegrationContainer(t, ctx)
+
+	model := ModelInfo{Model: "text-embedding-3-small", Version: "1"}
+	embeds := 0
+	embed := func(_ context.Context, text string) ([]float32, error) {
+		embeds++
+		return []float32{0.25, 0.5}, nil
+	}
+	hotel := Hotel{HotelID: "1", HotelName: "Smoke Test Inn", Description: "Quiet rooms near the old harbour", Rating: 4}
+	if _, err := UpsertHotel(ctx, container, hotel, "contentVector", embed, nil, model); err != nil {
+		t.Fatal(err)
+	}
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	for i, text := range []string{"Quiet rooms near", "near the old harbour"} {
+		body, err := json.Marshal(chunkDocument(hotel, "contentVector", i, text, []float32{0.5, 0.25}, model))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := container.CreateItem(ctx, pk, body, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unchanged: the vector and chunks are kept, and nothing is stale.
+	if _, err := UpsertHotel(ctx, container, hotel, "contentVector", embed, nil, model); err != nil {
+		t.Fatal(err)
+	}
+	if embeds != 1 {
+		t.Errorf("embedded %d times for an unchanged hotel, want 1", embeds)
+	}
+	if stale, err := FindStaleDocuments(ctx, container, model.Model); err != nil || len(stale) != 0 {
+		t.Errorf("FindStaleDocuments = %v, %v; want none", stale, err)
+	}
+	if chunks, _, err := findChunks(ctx, container, []string{"1"}, []string{}); err != nil || len(chunks) != 2 {
+		t.Errorf("chunks of an unchanged hotel = %v, %v; want both kept", chunks, err)
+	}
+
+	// Changed description: re-embedded, and the outdated chunks are gone.
+	hotel.Description = "Loud rooms above the night market"
+	if _, err := UpsertHotel(ctx, container, hotel, "contentVector", embed, nil, model); err != nil {
+		t.Fatal(err)
+	}
+	if embeds != 2 {
+		t.Errorf("embedded %d times after a description change, want 2", embeds)
+	}
+	if chunks, _, err := findChunks(ctx, container, []string{"1"}, []string{}); err != nil || len(chunks) != 0 {
+		t.Errorf("chunks after a description change = %v, %v; want none", chunks, err)
+	}
+}
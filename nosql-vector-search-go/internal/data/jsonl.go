@@ -0,0 +1,112 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// jsonlProgressInterval is how many lines LoadHotelsJSONL reads between
+// progress messages.
+const jsonlProgressInterval = 1000
+
+// JSONLStats tracks the outcome of a LoadHotelsJSONL call.
+type JSONLStats struct {
+	Loaded  int // hotels passed to the batch function
+	Skipped int // lines that were not a valid hotel
+}
+
+// LoadHotelsJSONL streams hotels from a newline-delimited JSON file (one hotel
+// object per line) and calls store with batches of up to batchSize hotels, so
+// files larger than memory can be loaded. See ReadHotelsJSONL.
+func LoadHotelsJSONL(ctx context.Context, filePath string, batchSize int, store func(context.Context, []Hotel) error) (*JSONLStats, error) {
+	fmt.Printf("Streaming JSONL file from %s\n", filePath)
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	stats, err := ReadHotelsJSONL(ctx, f, batchSize, store)
+	if err != nil {
+		return stats, fmt.Errorf("error streaming file %q: %w", filePath, err)
+	}
+
+	fmt.Printf("Loaded %d hotel documents, skipped %d invalid lines\n", stats.Loaded, stats.Skipped)
+	return stats, nil
+}
+
+// ReadHotelsJSONL reads one hotel per line from r and calls store with
+// batches of up to batchSize hotels; only one batch is held in memory at a
+// time. Blank lines are ignored. A line that is not valid JSON or has no
+// HotelId is logged and skipped rather than stopping the load. An error from
+// store, the reader, or the context stops reading and is returned.
+func ReadHotelsJSONL(ctx context.Context, r io.Reader, batchSize int, store func(context.Context, []Hotel) error) (*JSONLStats, error) {
+	if batchSize < 1 {
+		return nil, fmt.Errorf("batch size must be at least 1, got %d", batchSize)
+	}
+
+	stats := &JSONLStats{}
+	batch := make([]Hotel, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store(ctx, batch); err != nil {
+			return err
+		}
+		stats.Loaded += len(batch)
+		batch = make([]Hotel, 0, batchSize)
+		return nil
+	}
+
+	// bufio.Reader rather than Scanner: a line holding a hotel and its
+	// vector can exceed Scanner's default token size.
+	br := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		line, readErr := br.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return stats, readErr
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var h Hotel
+			err := json.Unmarshal(line, &h)
+			if err == nil && h.HotelID == "" {
+				err = errors.New("missing HotelId")
+			}
+			if err != nil {
+				stats.Skipped++
+				slog.WarnContext(ctx, "skipping invalid line", slog.Int("line", lineNum), slog.Any("error", err))
+			} else {
+				batch = append(batch, h)
+			}
+		}
+
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+		if lineNum%jsonlProgressInterval == 0 {
+			fmt.Printf("  read %d lines (%d loaded, %d skipped)\n", lineNum, stats.Loaded, stats.Skipped)
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+
+	return stats, flush()
+}
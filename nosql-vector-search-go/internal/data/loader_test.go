@@ -0,0 +1,81 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewDocumentStoresVectorInEmbeddedField(t *testing.T) {
+	h := Hotel{HotelID: "1", HotelName: "Hotel", DescriptionVector: []float32{0.1, 0.2}}
+
+	doc := newDocument(h, "contentVector")
+	if _, ok := doc["DescriptionVector"]; ok {
+		t.Error("document has DescriptionVector when the embedded field is contentVector")
+	}
+	if got, _ := doc["contentVector"].([]float32); !slices.Equal(got, h.DescriptionVector) {
+		t.Errorf("contentVector = %v, want %v", doc["contentVector"], h.DescriptionVector)
+	}
+}
+
+func TestStoredVectorField(t *testing.T) {
+	body, err := json.Marshal(newDocument(Hotel{HotelID: "1", DescriptionVector: []float32{0.5, 0.25}}, "contentVector"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := storedVectorField(body, "contentVector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{0.5, 0.25}; !slices.Equal(got, want) {
+		t.Errorf("contentVector = %v, want %v", got, want)
+	}
+
+	if got, err := storedVectorField(body, "DescriptionVector"); err != nil || got != nil {
+		t.Errorf("DescriptionVector = %v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestRequireVectorsNamesEmbeddedField(t *testing.T) {
+	hotels := []Hotel{{HotelID: "1", DescriptionVector: []float32{1}}, {HotelID: "2"}}
+
+	err := RequireVectors(hotels, "contentVector")
+	if !errors.Is(err, ErrMissingVectors) {
+		t.Fatalf("RequireVectors = %v, want ErrMissingVectors", err)
+	}
+	if !strings.Contains(err.Error(), "contentVector") || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("error %q does not name the field and count", err)
+	}
+	if err := RequireVectors(hotels[:1], "contentVector"); err != nil {
+		t.Errorf("RequireVectors with every vector present = %v", err)
+	}
+}
+
+func TestNewDocumentHashesOnlyEmbeddedText(t *testing.T) {
+	tmpl, err := NewEmbeddingTemplate("{{.HotelName}}: {{.Description}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hotels := []Hotel{
+		{HotelID: "1", HotelName: "Precomputed", Description: "Has a vector", DescriptionVector: []float32{0.1}},
+		{HotelID: "2", HotelName: "Embedded", Description: "Needs a vector"},
+	}
+	// With force set, planEmbeddings reads nothing from the container.
+	if _, _, _, err := planEmbeddings(t.Context(), nil, hotels[1:], "contentVector", tmpl, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if hash, ok := newDocument(hotels[0], "contentVector")["DescriptionHash"]; ok {
+		t.Errorf("precomputed vector stored with DescriptionHash %v", hash)
+	}
+	doc := newDocument(hotels[1], "contentVector")
+	if want := DescriptionHash("Embedded: Needs a vector"); doc["DescriptionHash"] != want {
+		t.Errorf("DescriptionHash = %v, want the hash of the rendered template %s", doc["DescriptionHash"], want)
+	}
+	if doc["EmbeddingTemplate"] != tmpl.Source() {
+		t.Errorf("EmbeddingTemplate = %v, want %q", doc["EmbeddingTemplate"], tmpl.Source())
+	}
+}
@@ -0,0 +1,309 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/query"
+)
+
+// MigrationTarget is the vector field and embedding model that
+// MigrateEmbeddings re-embeds documents into.
+type MigrationTarget struct {
+	// Field is the vector field the new embeddings are written to. It must
+	// differ from the field searches currently use, so they keep working
+	// while the migration runs.
+	Field string
+	Model ModelInfo
+}
+
+// modelKey and versionKey are the document properties that record which
+// model produced the vector in Field.
+func (t MigrationTarget) modelKey() string   { return t.Field + "Model" }
+func (t MigrationTarget) versionKey() string { return t.Field + "Version" }
+
+// MigrationResult tracks the outcome of a MigrateEmbeddings call.
+type MigrationResult struct {
+	MigratedCount int // documents re-embedded into the target field
+	Remaining     int // documents still to migrate when the call returned
+	RequestCharge float64
+}
+
+// Complete reports whether every document now has a vector from the target
+// model, so searches can switch to the target field.
+func (r *MigrationResult) Complete() bool {
+	return r.Remaining == 0
+}
+
+// migratingDocument is a stored hotel or chunk as read for re-embedding.
+type migratingDocument struct {
+	storedHotel
+	ParentID  string `json:"ParentId"`
+	ChunkText string `json:"ChunkText"`
+}
+
+// MigrateEmbeddings re-embeds every document whose target.Field was not
+// produced by target.Model, batchSize documents per embeddings call, and
+// patches the new vector into target.Field along with <Field>Model and
+// <Field>Version. Hotels are embedded from the same text as their current
+// vector (their stored EmbeddingTemplate), and chunk documents from their
+// ChunkText.
+//
+// The current vector field is never touched, so searches keep using it until
+// the caller switches them over with SetActiveEmbedding once the result is
+// Complete. Documents that
+// were already migrated are skipped, so an interrupted migration can be
+// resumed by calling MigrateEmbeddings again.
+func MigrateEmbeddings(ctx context.Context, container *azcosmos.ContainerClient, target MigrationTarget, embed BatchEmbedFunc, batchSize int) (*MigrationResult, error) {
+	if err := query.ValidateFieldName(target.Field); err != nil {
+		return nil, err
+	}
+	if target.Model.Model == "" {
+		return nil, fmt.Errorf("migration target model must not be empty")
+	}
+	if batchSize < 1 || batchSize > maxBatchOperations {
+		return nil, fmt.Errorf("migration batch size must be between 1 and %d, got %d", maxBatchOperations, batchSize)
+	}
+
+	result := &MigrationResult{}
+	ids, charge, err := unmigratedIDs(ctx, container, target)
+	result.RequestCharge += charge
+	result.Remaining = len(ids)
+	if err != nil {
+		return result, err
+	}
+	fmt.Printf("Migration: %d documents to re-embed into %s with %s\n", len(ids), target.Field, target.Model.Model)
+
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	for start := 0; start < len(ids); start += batchSize {
+		docs, charge, err := readMigratingDocuments(ctx, container, ids[start:min(start+batchSize, len(ids))])
+		result.RequestCharge += charge
+		if err != nil {
+			return result, err
+		}
+		if len(docs) == 0 {
+			continue
+		}
+
+		texts := make([]string, len(docs))
+		for i, d := range docs {
+			if d.ParentID != "" {
+				texts[i] = d.ChunkText
+				continue
+			}
+			var tmpl *EmbeddingTemplate
+			if d.EmbeddingTemplate != "" {
+				if tmpl, err = NewEmbeddingTemplate(d.EmbeddingTemplate); err != nil {
+					return result, fmt.Errorf("document %s: %w", d.ID, err)
+				}
+			}
+			if texts[i], err = embeddingText(tmpl, d.Hotel); err != nil {
+				return result, fmt.Errorf("document %s: %w", d.ID, err)
+			}
+		}
+
+		vectors, err := embed(ctx, texts)
+		if err != nil {
+			return result, fmt.Errorf("failed to embed documents for migration: %w", err)
+		}
+
+		// A patch carries the whole vector, about 40 KB at 3072 dimensions,
+		// so the batches are split by size like BulkUpsert's.
+		sizes := make([][]byte, len(vectors))
+		for i, v := range vectors {
+			if sizes[i], err = json.Marshal(v); err != nil {
+				return result, fmt.Errorf("failed to marshal vector of document %s: %w", docs[i].ID, err)
+			}
+		}
+		for _, r := range sizedBatches(sizes, maxBatchBytes) {
+			tb := container.NewTransactionalBatch(pk)
+			for i := r[0]; i < r[1]; i++ {
+				var ops azcosmos.PatchOperations
+				ops.AppendSet("/"+target.Field, vectors[i])
+				ops.AppendSet("/"+target.modelKey(), target.Model.Model)
+				ops.AppendSet("/"+target.versionKey(), target.Model.Version)
+				tb.PatchItem(docs[i].ID, ops, nil)
+			}
+			resp, err := container.ExecuteTransactionalBatch(ctx, tb, nil)
+			if err != nil {
+				return result, fmt.Errorf("failed to write migrated embeddings: %w", query.ClassifyError(err))
+			}
+			result.RequestCharge += float64(resp.RequestCharge)
+			if !resp.Success {
+				return result, fmt.Errorf("failed to write migrated embeddings: batch was rolled back")
+			}
+		}
+
+		result.MigratedCount += len(docs)
+		result.Remaining -= len(docs)
+		fmt.Printf("  migrated %d/%d documents\n", result.MigratedCount, len(ids))
+	}
+
+	// Documents written while the migration ran were not in ids.
+	ids, charge, err = unmigratedIDs(ctx, container, target)
+	result.RequestCharge += charge
+	if err != nil {
+		return result, err
+	}
+	result.Remaining = len(ids)
+	return result, nil
+}
+
+// unmigratedIDs returns the IDs of the documents whose target field was not
+// produced by the target model.
+func unmigratedIDs(ctx context.Context, container *azcosmos.ContainerClient, target MigrationTarget) ([]string, float64, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager(
+		"SELECT VALUE c.id FROM c WHERE NOT IS_DEFINED(c[@modelKey]) OR c[@modelKey] != @model OR c[@versionKey] != @version", pk,
+		&azcosmos.QueryOptions{QueryParameters: []azcosmos.QueryParameter{
+			{Name: "@modelKey", Value: target.modelKey()},
+			{Name: "@versionKey", Value: target.versionKey()},
+			{Name: "@model", Value: target.Model.Model},
+			{Name: "@version", Value: target.Model.Version},
+		}},
+	)
+
+	var ids []string
+	var charge float64
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, charge, fmt.Errorf("failed to find documents to migrate: %w", query.ClassifyError(err))
+		}
+		charge += float64(resp.RequestCharge)
+		for _, raw := range resp.Items {
+			var id string
+			if err := json.Unmarshal(raw, &id); err != nil {
+				return nil, charge, fmt.Errorf("failed to parse document id: %w", err)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, charge, nil
+}
+
+// readMigratingDocuments reads the listed documents. Documents deleted since
+// their IDs were read are left out.
+func readMigratingDocuments(ctx context.Context, container *azcosmos.ContainerClient, ids []string) ([]migratingDocument, float64, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager(
+		"SELECT * FROM c WHERE ARRAY_CONTAINS(@ids, c.id)", pk,
+		&azcosmos.QueryOptions{QueryParameters: []azcosmos.QueryParameter{{Name: "@ids", Value: ids}}},
+	)
+
+	var docs []migratingDocument
+	var charge float64
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, charge, fmt.Errorf("failed to read documents to migrate: %w", query.ClassifyError(err))
+		}
+		charge += float64(resp.RequestCharge)
+		for _, raw := range resp.Items {
+			var d migratingDocument
+			if err := json.Unmarshal(raw, &d); err != nil {
+				return nil, charge, fmt.Errorf("failed to parse document: %w", err)
+			}
+			d.HotelID = d.ID
+			docs = append(docs, d)
+		}
+	}
+	return docs, charge, nil
+}
+
+// settingsPartitionKey is the logical partition that holds the sample's
+// settings documents. Every hotel query is scoped to partitionKeyValue, so
+// searches, counts, and migrations never see them.
+const settingsPartitionKey = "_settings"
+
+// activeEmbeddingID is the id of the document SetActiveEmbedding writes.
+const activeEmbeddingID = "active-embedding"
+
+// ActiveEmbedding is the vector field, and the embedding model that fills
+// it, that searches and loads use. It is stored in the container, so that
+// finishing a migration switches every run over at once instead of each
+// client's EMBEDDED_FIELD and model settings having to change.
+type ActiveEmbedding struct {
+	Field      string
+	Model      ModelInfo
+	Dimensions int
+	// Deployment is the Azure OpenAI deployment of Model that queries are
+	// embedded with.
+	Deployment string
+	// RequestDimensions is set when Dimensions is sent as the dimensions
+	// parameter of every embeddings call, shortening Model's vectors.
+	RequestDimensions bool
+}
+
+// activeEmbeddingDocument is how an ActiveEmbedding is stored.
+type activeEmbeddingDocument struct {
+	ID           string `json:"id"`
+	PartitionKey string `json:"HotelId"`
+	Field        string `json:"Field"`
+	Model        string `json:"Model"`
+	Version      string `json:"Version"`
+	Dimensions   int    `json:"Dimensions"`
+	Deployment   string `json:"Deployment"`
+	// RequestDimensions is absent from documents written before it existed,
+	// which never shortened vectors.
+	RequestDimensions bool `json:"RequestDimensions,omitempty"`
+}
+
+// GetActiveEmbedding returns the active embedding recorded in the container,
+// or nil if SetActiveEmbedding was never called, in which case the
+// configured EMBEDDED_FIELD and model apply.
+func GetActiveEmbedding(ctx context.Context, container *azcosmos.ContainerClient) (*ActiveEmbedding, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(settingsPartitionKey)
+	resp, err := container.ReadItem(ctx, pk, activeEmbeddingID, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read active embedding: %w", query.ClassifyError(err))
+	}
+
+	var doc activeEmbeddingDocument
+	if err := json.Unmarshal(resp.Value, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse active embedding: %w", err)
+	}
+	return &ActiveEmbedding{
+		Field:             doc.Field,
+		Model:             ModelInfo{Model: doc.Model, Version: doc.Version},
+		Dimensions:        doc.Dimensions,
+		Deployment:        doc.Deployment,
+		RequestDimensions: doc.RequestDimensions,
+	}, nil
+}
+
+// SetActiveEmbedding records a as the embedding that searches and loads use
+// from now on. Call it once a MigrateEmbeddings result is Complete.
+func SetActiveEmbedding(ctx context.Context, container *azcosmos.ContainerClient, a ActiveEmbedding) error {
+	if err := query.ValidateFieldName(a.Field); err != nil {
+		return err
+	}
+	if a.Model.Model == "" || a.Dimensions < 1 || a.Deployment == "" {
+		return fmt.Errorf("active embedding needs a model, dimensions, and deployment")
+	}
+
+	body, err := json.Marshal(activeEmbeddingDocument{
+		ID:                activeEmbeddingID,
+		PartitionKey:      settingsPartitionKey,
+		Field:             a.Field,
+		Model:             a.Model.Model,
+		Version:           a.Model.Version,
+		Dimensions:        a.Dimensions,
+		Deployment:        a.Deployment,
+		RequestDimensions: a.RequestDimensions,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal active embedding: %w", err)
+	}
+	pk := azcosmos.NewPartitionKey().AppendString(settingsPartitionKey)
+	if _, err := container.UpsertItem(ctx, pk, body, nil); err != nil {
+		return fmt.Errorf("failed to write active embedding: %w", query.ClassifyError(err))
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package data
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetActiveEmbeddingValidates(t *testing.T) {
+	valid := ActiveEmbedding{Field: "DescriptionVector3", Model: ModelInfo{Model: "text-embedding-3-small"}, Dimensions: 1536, Deployment: "embed"}
+	tests := []struct {
+		name   string
+		change func(a *ActiveEmbedding)
+	}{
+		{"bad field", func(a *ActiveEmbedding) { a.Field = "vector; DROP" }},
+		{"no model", func(a *ActiveEmbedding) { a.Model.Model = "" }},
+		{"no dimensions", func(a *ActiveEmbedding) { a.Dimensions = 0 }},
+		{"no deployment", func(a *ActiveEmbedding) { a.Deployment = "" }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := valid
+			tc.change(&a)
+			// Rejected before the container is used.
+			if err := SetActiveEmbedding(context.Background(), nil, a); err == nil {
+				t.Error("SetActiveEmbedding accepted an incomplete active embedding")
+			}
+		})
+	}
+}
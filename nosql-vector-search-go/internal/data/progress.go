@@ -0,0 +1,88 @@
+package data
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ProgressFunc receives load progress: done of total documents handled after
+// elapsed, and the estimated time remaining at the rate so far. A total of 0
+// means the total is not known yet, as when streaming a JSONL file; eta is
+// then 0.
+type ProgressFunc func(done, total int, elapsed, eta time.Duration)
+
+// ConsoleProgress returns a ProgressFunc that rewrites a single line on w,
+// such as
+//
+//	Progress: 1200/5000 (24%), elapsed 12s, ETA 38s
+//
+// or "Progress: 1200 documents, elapsed 12s" while the total is unknown, and
+// ends it with a newline once every document is done. It is safe for
+// concurrent use; calls are serialized.
+func ConsoleProgress(w io.Writer) ProgressFunc {
+	var mu sync.Mutex
+	return func(done, total int, elapsed, eta time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if total == 0 {
+			fmt.Fprintf(w, "\rProgress: %d documents, elapsed %s ", done, elapsed.Round(time.Second))
+			return
+		}
+		fmt.Fprintf(w, "\rProgress: %d/%d (%d%%), elapsed %s, ETA %s ",
+			done, total, done*100/max(total, 1), elapsed.Round(time.Second), eta.Round(time.Second))
+		if done >= total {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// Progress times a load that may span several BulkUpsert calls, such as a
+// JSONL file stored one batch at a time, and reports the running total to a
+// ProgressFunc. Pass it to each call with WithSharedProgress and call Finish
+// after the last one. It is safe for concurrent use.
+type Progress struct {
+	mu    sync.Mutex
+	total int
+	done  int
+	start time.Time
+	fn    ProgressFunc
+}
+
+// NewProgress starts timing a load of total documents, or of an unknown
+// number when total is 0, reporting to fn.
+func NewProgress(total int, fn ProgressFunc) *Progress {
+	return &Progress{total: total, start: time.Now(), fn: fn}
+}
+
+// Add records n more documents as handled, whether they were written,
+// skipped, or failed, and reports the new total. The ETA assumes the
+// remaining documents go at the average rate so far.
+func (p *Progress) Add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if p.fn == nil || p.done == 0 {
+		return
+	}
+	elapsed := time.Since(p.start)
+	var eta time.Duration
+	if p.done < p.total {
+		eta = time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+	}
+	p.fn(p.done, p.total, elapsed, eta)
+}
+
+// Finish reports the load as complete: the total becomes the number of
+// documents handled, if it was unknown or not reached.
+func (p *Progress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fn == nil || p.done == 0 || p.done == p.total {
+		return
+	}
+	p.total = p.done
+	p.fn(p.done, p.total, time.Since(p.start), 0)
+}
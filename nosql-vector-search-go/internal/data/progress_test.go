@@ -0,0 +1,91 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// progressCall is one call of a ProgressFunc.
+type progressCall struct{ done, total int }
+
+func recordProgress(calls *[]progressCall) ProgressFunc {
+	return func(done, total int, _, _ time.Duration) {
+		*calls = append(*calls, progressCall{done, total})
+	}
+}
+
+func TestProgressAcrossCalls(t *testing.T) {
+	var calls []progressCall
+	p := NewProgress(10, recordProgress(&calls))
+	// Three BulkUpsert calls: every hotel counts, whether it was written,
+	// skipped as unchanged, or failed.
+	for _, n := range []int{4, 4, 2} {
+		p.Add(n)
+	}
+	p.Finish()
+
+	want := []progressCall{{4, 10}, {8, 10}, {10, 10}}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %v, want %v", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestProgressUnknownTotal(t *testing.T) {
+	// A JSONL file with invalid lines: only the hotels that reach store are
+	// counted, and Finish makes the count the total.
+	input := strings.Join([]string{
+		`{"HotelId":"1","HotelName":"One"}`,
+		`not json`,
+		`{"HotelId":"2","HotelName":"Two"}`,
+		`{"HotelName":"no id"}`,
+		`{"HotelId":"3","HotelName":"Three"}`,
+	}, "\n")
+
+	var calls []progressCall
+	p := NewProgress(0, recordProgress(&calls))
+	stats, err := ReadHotelsJSONL(context.Background(), strings.NewReader(input), 2, func(_ context.Context, hotels []Hotel) error {
+		p.Add(len(hotels))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Finish()
+
+	if stats.Loaded != 3 || stats.Skipped != 2 {
+		t.Errorf("stats = %+v, want 3 loaded and 2 skipped", stats)
+	}
+	want := []progressCall{{2, 0}, {3, 0}, {3, 3}}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %v, want %v", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestConsoleProgress(t *testing.T) {
+	var b bytes.Buffer
+	fn := ConsoleProgress(&b)
+
+	fn(3, 0, 2*time.Second, 0)
+	if got := b.String(); got != "\rProgress: 3 documents, elapsed 2s " {
+		t.Errorf("unknown total: got %q", got)
+	}
+
+	b.Reset()
+	fn(5, 5, 4*time.Second, 0)
+	if got := b.String(); got != "\rProgress: 5/5 (100%), elapsed 4s, ETA 0s \n" {
+		t.Errorf("done: got %q", got)
+	}
+}
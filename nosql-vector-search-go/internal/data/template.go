@@ -0,0 +1,61 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultEmbeddingTemplate embeds a hotel's name and tags along with its
+// description, which carry signal the description alone often lacks.
+const DefaultEmbeddingTemplate = `{{.HotelName}}. {{.Description}} Tags: {{join .Tags ", "}}`
+
+// EmbeddingTemplate builds the text that is embedded for a hotel from a
+// text/template over the Hotel struct. Besides the built-in template
+// functions it provides join (strings.Join).
+type EmbeddingTemplate struct {
+	source string
+	tmpl   *template.Template
+}
+
+// NewEmbeddingTemplate parses source and checks it against an empty hotel, so
+// a syntax error or a reference to a field Hotel does not have is reported
+// here rather than halfway through a load.
+func NewEmbeddingTemplate(source string) (*EmbeddingTemplate, error) {
+	tmpl, err := template.New("embedding").
+		Funcs(template.FuncMap{"join": strings.Join}).
+		Option("missingkey=error").
+		Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedding template: %w", err)
+	}
+
+	t := &EmbeddingTemplate{source: source, tmpl: tmpl}
+	if _, err := t.Text(Hotel{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Text renders the template for a hotel.
+func (t *EmbeddingTemplate) Text(h Hotel) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, h); err != nil {
+		return "", fmt.Errorf("invalid embedding template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// Source returns the template text the EmbeddingTemplate was parsed from.
+func (t *EmbeddingTemplate) Source() string {
+	return t.source
+}
+
+// embeddingText returns the text embedded for a hotel: the rendered template,
+// or the description alone when tmpl is nil.
+func embeddingText(tmpl *EmbeddingTemplate, h Hotel) (string, error) {
+	if tmpl == nil {
+		return h.Description, nil
+	}
+	return tmpl.Text(h)
+}
@@ -0,0 +1,34 @@
+package data
+
+import "testing"
+
+func TestEmbeddingTemplate(t *testing.T) {
+	hotel := Hotel{HotelName: "Stay Inn", Description: "Quiet rooms."}
+	tests := []struct {
+		name   string
+		source string
+		want   string // rendered for hotel; "" means NewEmbeddingTemplate fails
+	}{
+		{"syntax error", "{{.HotelName", ""},
+		{"unknown field", "{{.NoSuchField}}", ""},
+		{"default with nil tags", DefaultEmbeddingTemplate, "Stay Inn. Quiet rooms. Tags: "},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := NewEmbeddingTemplate(tc.source)
+			if tc.want == "" {
+				if err == nil {
+					t.Errorf("NewEmbeddingTemplate(%q) succeeded, want an error", tc.source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tmpl.Text(hotel)
+			if err != nil || got != tc.want {
+				t.Errorf("Text = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+}
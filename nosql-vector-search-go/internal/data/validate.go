@@ -0,0 +1,110 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidHotel is matched by errors.Is for every *ValidationError and for
+// ValidationErrors.
+var ErrInvalidHotel = errors.New("invalid hotel")
+
+// Ratings outside this range are rejected by Validate.
+const (
+	minRating = 0.0
+	maxRating = 5.0
+)
+
+// ValidationError lists every problem Validate found with one hotel.
+type ValidationError struct {
+	HotelID  string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("hotel %q: %s", e.HotelID, strings.Join(e.Problems, "; "))
+}
+
+// Is reports whether target is ErrInvalidHotel.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidHotel
+}
+
+// ValidationErrors collects the invalid hotels of a batch, so callers see all
+// of them at once instead of only the first.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return fmt.Sprintf("%d invalid hotels: %s", len(e), strings.Join(msgs, ", "))
+}
+
+// Is reports whether target is ErrInvalidHotel.
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrInvalidHotel
+}
+
+// Validate checks the fields a searchable hotel needs: a HotelId and
+// HotelName, a Rating between 0 and 5, and a DescriptionVector with
+// expectedDimensions dimensions. Pass 0 to skip the dimension check, for
+// example when the container has no vector policy. It returns a
+// *ValidationError listing every problem found, or nil.
+func (h Hotel) Validate(expectedDimensions int) error {
+	var problems []string
+	if strings.TrimSpace(h.HotelID) == "" {
+		problems = append(problems, "HotelId is empty")
+	}
+	if strings.TrimSpace(h.HotelName) == "" {
+		problems = append(problems, "HotelName is empty")
+	}
+	// The negated comparison also rejects NaN.
+	if !(h.Rating >= minRating && h.Rating <= maxRating) {
+		problems = append(problems, fmt.Sprintf("Rating %v is not between %v and %v", h.Rating, minRating, maxRating))
+	}
+	if expectedDimensions > 0 && len(h.DescriptionVector) != expectedDimensions {
+		problems = append(problems, fmt.Sprintf("DescriptionVector has %d dimensions, expected %d", len(h.DescriptionVector), expectedDimensions))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{HotelID: h.HotelID, Problems: problems}
+}
+
+// ErrMissingVectors is returned by RequireVectors when some hotels have no
+// DescriptionVector.
+var ErrMissingVectors = errors.New("hotels are missing precomputed vectors")
+
+// maxListedIDs caps how many hotel IDs RequireVectors names in its error.
+const maxListedIDs = 5
+
+// RequireVectors checks that every hotel carries its own DescriptionVector,
+// for loading embeddings computed elsewhere into embeddedField without
+// calling Azure OpenAI. A
+// mix of hotels with and without vectors usually means the export is
+// incomplete, so the error counts the missing ones and names the first few.
+// Dimensions are checked later, against the container's vector policy, by
+// BulkUpsert.
+func RequireVectors(hotels []Hotel, embeddedField string) error {
+	var missing []string
+	for _, h := range hotels {
+		if len(h.DescriptionVector) == 0 {
+			missing = append(missing, h.HotelID)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	listed := missing[:min(len(missing), maxListedIDs)]
+	more := ""
+	if len(missing) > len(listed) {
+		more = fmt.Sprintf(" and %d more", len(missing)-len(listed))
+	}
+	return fmt.Errorf("%w: %d of %d hotels have no DescriptionVector to store in %s (%s%s)",
+		ErrMissingVectors, len(missing), len(hotels), embeddedField, strings.Join(listed, ", "), more)
+}
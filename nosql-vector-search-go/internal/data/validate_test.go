@@ -0,0 +1,124 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// quickHotel is a Hotel generated by testing/quick with values near the
+// validation boundaries: blank names and IDs, ratings just outside 0-5 and
+// NaN, and vectors one dimension short or long.
+type quickHotel struct {
+	Hotel
+	Dims int
+}
+
+func (quickHotel) Generate(r *rand.Rand, _ int) reflect.Value {
+	pick := func(values ...string) string { return values[r.Intn(len(values))] }
+	ratings := []float64{0, 5, 2.5, -0.01, 5.01, -1, 100, math.NaN(), math.Inf(1)}
+	dims := 1 + r.Intn(8)
+	vectorLen := dims + r.Intn(3) - 1 // dims-1, dims, or dims+1
+
+	h := quickHotel{
+		Hotel: Hotel{
+			HotelID:           pick("", " ", "1", "hotel-42"),
+			HotelName:         pick("", "\t", "Stay Inn"),
+			Rating:            ratings[r.Intn(len(ratings))],
+			DescriptionVector: make([]float32, vectorLen),
+		},
+		Dims: dims,
+	}
+	if r.Intn(4) == 0 {
+		h.Dims = 0 // no vector policy: any vector length is accepted
+	}
+	return reflect.ValueOf(h)
+}
+
+// problems returns how many of Validate's rules h breaks.
+func (h quickHotel) problems() int {
+	n := 0
+	if strings.TrimSpace(h.HotelID) == "" {
+		n++
+	}
+	if strings.TrimSpace(h.HotelName) == "" {
+		n++
+	}
+	if !(h.Rating >= minRating && h.Rating <= maxRating) {
+		n++
+	}
+	if h.Dims > 0 && len(h.DescriptionVector) != h.Dims {
+		n++
+	}
+	return n
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	property := func(h quickHotel) bool {
+		err := h.Validate(h.Dims)
+		want := h.problems()
+		if want == 0 {
+			return err == nil
+		}
+		var verr *ValidationError
+		return errors.As(err, &verr) && errors.Is(err, ErrInvalidHotel) &&
+			verr.HotelID == h.HotelID && len(verr.Problems) == want
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSplitValidKeepsEveryHotel(t *testing.T) {
+	property := func(generated []quickHotel) bool {
+		// One container, one vector policy: every hotel is checked against
+		// the same dimensions.
+		dims := 4
+		hotels := make([]Hotel, len(generated))
+		for i, h := range generated {
+			hotels[i] = h.Hotel
+		}
+
+		valid, invalid := splitValid(hotels, dims)
+		if len(valid)+len(invalid) != len(hotels) {
+			return false
+		}
+		// Both lists keep the input order, and each hotel lands in the list
+		// its own Validate result puts it in.
+		v, iv := 0, 0
+		for _, h := range hotels {
+			if h.Validate(dims) == nil {
+				if v >= len(valid) || valid[v].HotelID != h.HotelID {
+					return false
+				}
+				v++
+			} else {
+				if iv >= len(invalid) || invalid[iv].HotelID != h.HotelID {
+					return false
+				}
+				iv++
+			}
+		}
+		return len(invalid) == 0 || errors.Is(invalid, ErrInvalidHotel)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidationErrorsListsAll(t *testing.T) {
+	errs := ValidationErrors{
+		{HotelID: "1", Problems: []string{"HotelName is empty"}},
+		{HotelID: "2", Problems: []string{"Rating 7 is not between 0 and 5", "DescriptionVector has 3 dimensions, expected 4"}},
+	}
+	msg := errs.Error()
+	for _, want := range []string{"2 invalid hotels", `hotel "1": HotelName is empty`, `hotel "2": Rating 7 is not between 0 and 5; DescriptionVector has 3 dimensions`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+}
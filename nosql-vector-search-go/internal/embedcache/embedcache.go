@@ -0,0 +1,201 @@
+// Package embedcache stores embeddings by model and text, so repeated
+// queries don't call the embeddings API again.
+package embedcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Cache stores embeddings keyed by model and normalized text (see Key).
+// Implementations are safe for concurrent use.
+type Cache interface {
+	// Get returns the cached embedding of text produced by model.
+	Get(model, text string) ([]float32, bool)
+	// Put stores the embedding of text produced by model.
+	Put(model, text string, vector []float32)
+	// Stats returns the hits and misses of Get so far.
+	Stats() Stats
+}
+
+// Stats counts cache lookups.
+type Stats struct {
+	Hits   int64
+	Misses int64
+}
+
+// Key returns the cache key for text embedded by model. Case and runs of
+// whitespace are normalized, so "Hotels near  the beach" and "hotels near the
+// beach" share an entry.
+func Key(model, text string) string {
+	return model + "\x00" + strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// counters implements Stats for the caches in this package.
+type counters struct {
+	hits, misses atomic.Int64
+}
+
+func (c *counters) record(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+func (c *counters) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// LRU is an in-memory Cache holding at most a fixed number of embeddings;
+// adding one more evicts the least recently used.
+type LRU struct {
+	counters
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key    string
+	vector []float32
+}
+
+// NewLRU returns an empty LRU that holds up to capacity embeddings (at least
+// one).
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache. The vector returned is a copy, so a caller that
+// modifies it (to normalize it, say) does not change the cached entry.
+func (c *LRU) Get(model, text string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[Key(model, text)]
+	c.record(ok)
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return slices.Clone(e.Value.(*lruEntry).vector), true
+}
+
+// Put implements Cache. A copy of vector is stored, for the same reason.
+func (c *LRU) Put(model, text string, vector []float32) {
+	key := Key(model, text)
+	vector = slices.Clone(vector)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry).vector = vector
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, vector: vector})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Len returns the number of cached embeddings.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Disk is a Cache that keeps one JSON file per embedding in a directory, so
+// entries survive between runs. It never evicts; delete the directory to
+// clear it.
+type Disk struct {
+	counters
+	dir string
+}
+
+// NewDisk returns a Disk cache in dir, creating the directory if needed.
+func NewDisk(dir string) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create embedding cache directory %q: %w", dir, err)
+	}
+	return &Disk{dir: dir}, nil
+}
+
+// path returns the file that holds the entry for key.
+func (c *Disk) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get implements Cache. An unreadable entry is logged and counted as a miss.
+func (c *Disk) Get(model, text string) ([]float32, bool) {
+	raw, err := os.ReadFile(c.path(Key(model, text)))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to read embedding cache entry", slog.Any("error", err))
+		}
+		c.record(false)
+		return nil, false
+	}
+
+	var vector []float32
+	if err := json.Unmarshal(raw, &vector); err != nil {
+		slog.Warn("ignoring corrupt embedding cache entry", slog.Any("error", err))
+		c.record(false)
+		return nil, false
+	}
+	c.record(true)
+	return vector, true
+}
+
+// Put implements Cache. The entry is written to a temporary file and renamed
+// into place, so a concurrent Get never sees a partial entry. Write errors
+// are logged; the embedding is simply not cached.
+func (c *Disk) Put(model, text string, vector []float32) {
+	raw, err := json.Marshal(vector)
+	if err != nil {
+		slog.Warn("failed to encode embedding cache entry", slog.Any("error", err))
+		return
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "entry-*.tmp")
+	if err != nil {
+		slog.Warn("failed to write embedding cache entry", slog.Any("error", err))
+		return
+	}
+	_, err = tmp.Write(raw)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(Key(model, text)))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		slog.Warn("failed to write embedding cache entry", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,98 @@
+package embedcache
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestKeyNormalizesText(t *testing.T) {
+	if Key("m", "Hotels near  the\tbeach ") != Key("m", "hotels near the beach") {
+		t.Error("keys differ in case or whitespace only")
+	}
+	if Key("m1", "beach") == Key("m2", "beach") {
+		t.Error("keys of different models are equal")
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(3)
+	for _, text := range []string{"a", "b", "c"} {
+		c.Put("m", text, []float32{1})
+	}
+	c.Get("m", "a")               // order: a c b
+	c.Put("m", "d", []float32{1}) // evicts b
+	c.Put("m", "c", []float32{2}) // updates c, order: c d a
+	c.Put("m", "e", []float32{1}) // evicts a
+
+	for text, want := range map[string]bool{"a": false, "b": false, "c": true, "d": true, "e": true} {
+		if _, ok := c.Get("m", text); ok != want {
+			t.Errorf("Get(%q) found = %v, want %v", text, ok, want)
+		}
+	}
+	if v, _ := c.Get("m", "c"); !slices.Equal(v, []float32{2}) {
+		t.Errorf("Get(c) = %v, want the updated vector [2]", v)
+	}
+	if c.Len() != 3 {
+		t.Errorf("Len = %d, want 3", c.Len())
+	}
+	if got, want := c.Stats(), (Stats{Hits: 5, Misses: 2}); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestLRUCopiesVectors(t *testing.T) {
+	c := NewLRU(1)
+	vector := []float32{1, 2}
+	c.Put("m", "a", vector)
+	vector[0] = 9
+
+	got, _ := c.Get("m", "a")
+	got[1] = 9
+	if again, _ := c.Get("m", "a"); !slices.Equal(again, []float32{1, 2}) {
+		t.Errorf("cached vector = %v after callers modified theirs, want [1 2]", again)
+	}
+}
+
+// TestLRUConcurrentUse is meant for go test -race.
+func TestLRUConcurrentUse(t *testing.T) {
+	c := NewLRU(16)
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				text := fmt.Sprint(i % 32)
+				if v, ok := c.Get("m", text); ok {
+					v[0]++ // must not race with other readers
+				} else {
+					c.Put("m", text, []float32{float32(g)})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.Len() > 16 {
+		t.Errorf("Len = %d, want at most the capacity 16", c.Len())
+	}
+	if s := c.Stats(); s.Hits+s.Misses != 8*200 {
+		t.Errorf("Stats = %+v, want %d lookups", s, 8*200)
+	}
+}
+
+func TestDiskRoundTrip(t *testing.T) {
+	c, err := NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("m", "beach"); ok {
+		t.Error("Get found an entry in an empty cache")
+	}
+	c.Put("m", "beach", []float32{0.5, -1})
+	if v, ok := c.Get("m", "Beach"); !ok || !slices.Equal(v, []float32{0.5, -1}) {
+		t.Errorf("Get = %v, %v, want [0.5 -1], true", v, ok)
+	}
+}
@@ -0,0 +1,59 @@
+package query
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// chunkCandidateMultiplier sets how many ranked documents a chunk-collapsing
+// search reads, so several chunks of one hotel don't leave fewer than Top
+// hotels once they are collapsed.
+const chunkCandidateMultiplier = 3
+
+// executeCollapsedSearch runs ExecuteVectorSearch over a larger candidate
+// set, collapses chunk hits into their parent hotels with CollapseChunks, and
+// returns the requested page of what is left.
+func executeCollapsedSearch(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	options *SearchOptions,
+	opts []SearchOption,
+) ([]QueryResult, float64, error) {
+	candidateOpts := append(opts[:len(opts):len(opts)],
+		WithSkip(0), WithTop(options.fetchCount()*chunkCandidateMultiplier), withoutCollapseChunks())
+	candidates, charge, err := ExecuteVectorSearch(ctx, container, embedding, embeddedField, distanceFunction, candidateOpts...)
+	if err != nil {
+		return nil, charge, err
+	}
+
+	results := CollapseChunks(candidates)
+	if len(results) > options.fetchCount() {
+		results = results[:options.fetchCount()]
+	}
+	return page(options, results), charge, nil
+}
+
+// CollapseChunks merges chunk documents into their parent hotel, keeping the
+// best-ranked hit for each hotel. A collapsed result's ID is the parent
+// hotel's, and its ChunkText is the passage that matched, or empty when the
+// hotel document itself ranked first.
+func CollapseChunks(results []QueryResult) []QueryResult {
+	var collapsed []QueryResult
+	seen := make(map[string]bool, len(results))
+
+	for _, r := range results {
+		if r.ParentID != "" {
+			r.ID, r.ParentID = r.ParentID, ""
+		}
+		if seen[r.ID] {
+			continue
+		}
+		seen[r.ID] = true
+		collapsed = append(collapsed, r)
+	}
+	return collapsed
+}
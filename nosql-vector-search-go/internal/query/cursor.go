@@ -0,0 +1,146 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"iter"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// ResultCursor streams the results of a vector search. Create one with
+// VectorSearchCursor.
+type ResultCursor struct {
+	// rows runs the query and yields its rows, best first, adding the
+	// request charge of each page to charge.
+	rows             func(ctx context.Context, charge *float64) iter.Seq2[QueryResult, error]
+	distanceFunction string
+	options          *SearchOptions
+	charge           float64
+}
+
+// VectorSearchCursor prepares a vector search whose results are read one at a
+// time instead of collected into a slice, for large result sets such as
+// exports or evaluations (for example WithTop(1000)). Pages are fetched from
+// the service only as the caller consumes them, so stopping early saves the
+// remaining requests.
+//
+// WithSkip, WithMinScore, WithTimeout, WithNegativeExamples,
+// WithCollapseChunks, and the filter options behave as in
+// ExecuteVectorSearch; the timeout bounds each call of Results. WithDedupe
+// is rejected, since deduplication needs the whole candidate list.
+func VectorSearchCursor(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	opts ...SearchOption,
+) (*ResultCursor, error) {
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if options.Dedupe {
+		return nil, errors.New("VectorSearchCursor does not support WithDedupe")
+	}
+	if err := ValidateFieldName(embeddedField); err != nil {
+		return nil, err
+	}
+	if err := CheckDimensions(ctx, container, embeddedField, len(embedding)); err != nil {
+		return nil, err
+	}
+	for _, v := range options.NegativeExamples {
+		if len(v) != len(embedding) {
+			return nil, &DimensionMismatchError{Field: "negative example", Expected: len(embedding), Actual: len(v)}
+		}
+	}
+
+	// Collapsing drops every chunk after a hotel's best hit, so the query
+	// reads the same larger candidate set as ExecuteVectorSearch.
+	queryOptions := *options
+	if options.CollapseChunks {
+		queryOptions.Skip, queryOptions.Top = 0, options.fetchCount()*chunkCandidateMultiplier
+	}
+	queryText, params, err := buildVectorQuery(embedding, embeddedField, distanceFunction, &queryOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResultCursor{
+		rows: func(ctx context.Context, charge *float64) iter.Seq2[QueryResult, error] {
+			return queryRows(ctx, container, queryText, params, charge)
+		},
+		distanceFunction: distanceFunction,
+		options:          options,
+	}, nil
+}
+
+// Results runs the query with ctx and yields each result in ranked order. Breaking out
+// of the loop stops the query; a failed request, a cancelled context, or an
+// expired WithTimeout yields the error and ends the sequence. Each call runs
+// the query again.
+//
+//	for r, err := range cursor.Results(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (c *ResultCursor) Results(ctx context.Context) iter.Seq2[QueryResult, error] {
+	return func(yield func(QueryResult, error) bool) {
+		ctx, cancel := c.options.withTimeout(ctx)
+		defer cancel()
+
+		skipped, yielded := 0, 0
+		seen := make(map[string]bool)
+		for r, err := range c.rows(ctx, &c.charge) {
+			if err != nil {
+				yield(QueryResult{}, err)
+				return
+			}
+
+			r.DistanceFunction = c.distanceFunction
+			r.NormalizedScore = NormalizeScore(r.SimilarityScore, c.distanceFunction)
+			// Rows arrive best first, so the first one below the threshold
+			// ends the results.
+			if !c.options.meetsMinScore(r.SimilarityScore, c.distanceFunction) {
+				return
+			}
+			if len(c.options.NegativeExamples) > 0 {
+				if len(FilterNegativeExamples([]QueryResult{r}, c.options.NegativeExamples, c.options.NegativeThreshold)) == 0 {
+					continue
+				}
+				if !c.options.IncludeVectors {
+					r.Vector = nil
+				}
+			}
+			if c.options.CollapseChunks {
+				// The first hit of a hotel is its best one.
+				if r.ParentID != "" {
+					r.ID, r.ParentID = r.ParentID, ""
+				}
+				if seen[r.ID] {
+					continue
+				}
+				seen[r.ID] = true
+			}
+
+			if skipped < c.options.Skip {
+				skipped++
+				continue
+			}
+			if !yield(r, nil) {
+				return
+			}
+			if yielded++; yielded == c.options.Top {
+				return
+			}
+		}
+	}
+}
+
+// RequestCharge returns the request units consumed by the pages read so far.
+func (c *ResultCursor) RequestCharge() float64 {
+	return c.charge
+}
@@ -0,0 +1,184 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"testing"
+	"time"
+)
+
+// fakeRows yields rows in pages of pageSize, checking the context before each
+// page as the SDK pager does. stopped is set when the consumer stops early.
+type fakeRows struct {
+	rows     []QueryResult
+	pageSize int
+	// wait, when set, blocks each page until the context is done.
+	wait    bool
+	stopped bool
+}
+
+func (f *fakeRows) seq(ctx context.Context, charge *float64) iter.Seq2[QueryResult, error] {
+	return func(yield func(QueryResult, error) bool) {
+		for i, r := range f.rows {
+			if i%f.pageSize == 0 {
+				if f.wait {
+					<-ctx.Done()
+				}
+				if err := ctx.Err(); err != nil {
+					yield(QueryResult{}, fmt.Errorf("query failed: %w", ClassifyError(err)))
+					return
+				}
+				*charge++
+			}
+			if !yield(r, nil) {
+				f.stopped = true
+				return
+			}
+		}
+	}
+}
+
+// newTestCursor returns a cursor over rows with the given options.
+func newTestCursor(t *testing.T, rows *fakeRows, opts ...SearchOption) *ResultCursor {
+	t.Helper()
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ResultCursor{rows: rows.seq, distanceFunction: DistanceCosine, options: options}
+}
+
+// rankedRows returns n rows with falling scores and IDs "0" to "n-1".
+func rankedRows(n int) []QueryResult {
+	rows := make([]QueryResult, n)
+	for i := range rows {
+		rows[i] = QueryResult{ID: fmt.Sprint(i), SimilarityScore: 1 - float64(i)/100}
+	}
+	return rows
+}
+
+// collect reads every result, stopping at the first error.
+func collect(c *ResultCursor, ctx context.Context) ([]QueryResult, error) {
+	var results []QueryResult
+	for r, err := range c.Results(ctx) {
+		if err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func TestCursorBreakStopsQuery(t *testing.T) {
+	rows := &fakeRows{rows: rankedRows(10), pageSize: 3}
+	c := newTestCursor(t, rows, WithTop(10))
+
+	for r, err := range c.Results(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ID == "1" {
+			break
+		}
+	}
+	if !rows.stopped {
+		t.Error("breaking out of Results did not stop the query")
+	}
+	if c.RequestCharge() != 1 {
+		t.Errorf("read %v pages, want only the first", c.RequestCharge())
+	}
+}
+
+func TestCursorCanceledMidIteration(t *testing.T) {
+	rows := &fakeRows{rows: rankedRows(10), pageSize: 2}
+	c := newTestCursor(t, rows, WithTop(10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got int
+	var err error
+	for r, rerr := range c.Results(ctx) {
+		if rerr != nil {
+			err = rerr
+			break
+		}
+		got++
+		if r.ID == "2" {
+			cancel()
+		}
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	// The page holding "2" is finished before the next page sees the
+	// cancellation.
+	if got != 4 {
+		t.Errorf("yielded %d results before the error, want 4", got)
+	}
+}
+
+func TestCursorTimeout(t *testing.T) {
+	rows := &fakeRows{rows: rankedRows(4), pageSize: 2, wait: true}
+	c := newTestCursor(t, rows, WithTop(4), WithTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	_, err := collect(c, context.Background())
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want ErrTimeout wrapping context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out after %v, want about 20ms", elapsed)
+	}
+}
+
+func TestCursorNegativeExamples(t *testing.T) {
+	rows := &fakeRows{pageSize: 10, rows: []QueryResult{
+		{ID: "0", SimilarityScore: 0.9, Vector: []float32{1, 0}},
+		{ID: "1", SimilarityScore: 0.8, Vector: []float32{0, 1}},
+		{ID: "2", SimilarityScore: 0.7, Vector: []float32{0.99, 0.1}},
+		{ID: "3", SimilarityScore: 0.6, Vector: []float32{0.2, 0.98}},
+	}}
+	c := newTestCursor(t, rows, WithTop(4), WithNegativeExamples([][]float32{{1, 0}}))
+
+	results, err := collect(c, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(results); got != "1,3" {
+		t.Errorf("results = %s, want 1,3", got)
+	}
+	for _, r := range results {
+		if r.Vector != nil {
+			t.Errorf("result %s kept its vector without WithVectors", r.ID)
+		}
+	}
+}
+
+func TestCursorCollapseChunks(t *testing.T) {
+	rows := &fakeRows{pageSize: 10, rows: []QueryResult{
+		{ID: "a_chunk_1", ParentID: "a", SimilarityScore: 0.9},
+		{ID: "a", SimilarityScore: 0.8},
+		{ID: "b_chunk_0", ParentID: "b", SimilarityScore: 0.7},
+		{ID: "a_chunk_0", ParentID: "a", SimilarityScore: 0.6},
+		{ID: "c", SimilarityScore: 0.5},
+		{ID: "d", SimilarityScore: 0.4},
+	}}
+	c := newTestCursor(t, rows, WithTop(2), WithSkip(1), WithCollapseChunks())
+
+	results, err := collect(c, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(results); got != "b,c" {
+		t.Errorf("results = %s, want b,c", got)
+	}
+}
+
+func TestVectorSearchCursorRejectsDedupe(t *testing.T) {
+	_, err := VectorSearchCursor(context.Background(), nil, []float32{1}, "DescriptionVector", DistanceCosine, WithDedupe(0))
+	if err == nil {
+		t.Error("VectorSearchCursor accepted WithDedupe")
+	}
+}
@@ -0,0 +1,95 @@
+package query
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// DefaultDedupeThreshold is the cosine similarity above which two results are
+// treated as the same hotel when WithDedupe is given zero.
+const DefaultDedupeThreshold = 0.98
+
+// dedupeCandidateMultiplier sets how many ranked documents a deduplicated
+// search reads, so dropped duplicates can be replaced from deeper results.
+const dedupeCandidateMultiplier = 3
+
+// executeDedupedSearch runs ExecuteVectorSearch over a larger candidate set
+// with embeddings, removes near-duplicates with DedupeResults, and returns the
+// requested page of what is left.
+func executeDedupedSearch(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	options *SearchOptions,
+	opts []SearchOption,
+) ([]QueryResult, float64, error) {
+	candidateOpts := append(opts[:len(opts):len(opts)],
+		WithSkip(0), WithTop(options.fetchCount()*dedupeCandidateMultiplier), WithVectors(), withoutDedupe())
+	candidates, charge, err := ExecuteVectorSearch(ctx, container, embedding, embeddedField, distanceFunction, candidateOpts...)
+	if err != nil {
+		return nil, charge, err
+	}
+	return dedupePage(candidates, options), charge, nil
+}
+
+// dedupePage removes near-duplicates from ranked candidates and returns the
+// requested page of what is left, so hotels ranked below a dropped duplicate
+// move up to fill its place.
+func dedupePage(candidates []QueryResult, options *SearchOptions) []QueryResult {
+	results := DedupeResults(candidates, options.DedupeThreshold)
+	if len(results) > options.fetchCount() {
+		results = results[:options.fetchCount()]
+	}
+	if !options.IncludeVectors {
+		for i := range results {
+			results[i].Vector = nil
+		}
+	}
+	return page(options, results)
+}
+
+// DedupeResults removes near-duplicate hotels from a ranked result list,
+// keeping the best-ranked copy of each. Two results are duplicates when the
+// cosine similarity of their vectors is at least threshold, or when their
+// hotel names are equal after normalizing case, punctuation, and spacing.
+// Results must carry their Vector for the similarity check.
+func DedupeResults(results []QueryResult, threshold float64) []QueryResult {
+	var kept []QueryResult
+	names := make(map[string]bool, len(results))
+
+	for _, r := range results {
+		name := normalizeHotelName(r.HotelName)
+		if name != "" && names[name] {
+			continue
+		}
+
+		duplicate := false
+		for _, k := range kept {
+			if CosineSimilarity(r.Vector, k.Vector) >= threshold {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+
+		kept = append(kept, r)
+		names[name] = true
+	}
+	return kept
+}
+
+// normalizeHotelName lowercases a name and reduces it to its words, so
+// "The Grand Hotel" and "the grand hotel!" compare equal.
+func normalizeHotelName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
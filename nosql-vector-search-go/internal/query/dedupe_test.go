@@ -0,0 +1,87 @@
+package query
+
+import (
+	"strings"
+	"testing"
+)
+
+// resultIDs returns the IDs of results joined by commas.
+func resultIDs(results []QueryResult) string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// syntheticResults returns a ranked list in which "1b" repeats hotel 1's
+// vector under another name and "2b" repeats hotel 2's name with a different
+// vector.
+func syntheticResults() []QueryResult {
+	return []QueryResult{
+		{ID: "1", HotelName: "Harbor View Inn", Vector: []float32{1, 0, 0}},
+		{ID: "1b", HotelName: "Harbour View", Vector: []float32{0.999, 0.01, 0}},
+		{ID: "2", HotelName: "The Grand Hotel", Vector: []float32{0, 1, 0}},
+		{ID: "2b", HotelName: "the  grand hotel!", Vector: []float32{0, 0, 1}},
+		{ID: "3", HotelName: "Mountain Lodge", Vector: []float32{0.6, 0.8, 0}},
+		{ID: "4", HotelName: "City Suites", Vector: []float32{0, 0.6, 0.8}},
+	}
+}
+
+func TestDedupeResults(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		want      string
+	}{
+		{"default threshold", DefaultDedupeThreshold, "1,2,3,4"},
+		{"loose threshold merges similar vectors", 0.5, "1,2"},
+		{"threshold of one keeps near matches", 1, "1,1b,2,3,4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resultIDs(DedupeResults(syntheticResults(), tt.threshold)); got != tt.want {
+				t.Errorf("kept %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupePageBackfills(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []SearchOption
+		want string
+	}{
+		{"top is honoured after duplicates are dropped", []SearchOption{WithTop(3), WithDedupe(0)}, "1,2,3"},
+		{"skip counts distinct hotels", []SearchOption{WithTop(2), WithSkip(2), WithDedupe(0)}, "3,4"},
+		{"short page when candidates run out", []SearchOption{WithTop(5), WithDedupe(0)}, "1,2,3,4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := newSearchOptions(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results := dedupePage(syntheticResults(), options)
+			if got := resultIDs(results); got != tt.want {
+				t.Errorf("page = %s, want %s", got, tt.want)
+			}
+			for _, r := range results {
+				if r.Vector != nil {
+					t.Errorf("result %s kept its vector without WithVectors", r.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeHotelName(t *testing.T) {
+	for _, name := range []string{"The Grand Hotel", "the grand hotel!", "  THE-GRAND   hotel "} {
+		if got := normalizeHotelName(name); got != "the grand hotel" {
+			t.Errorf("normalizeHotelName(%q) = %q, want %q", name, got, "the grand hotel")
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+)
+
+// DefaultEmbeddingBatchSize is the number of inputs sent per embeddings call
+// when GenerateEmbeddingsBatch is given a batch size of zero or less.
+const DefaultEmbeddingBatchSize = 512
+
+// MaxEmbeddingBatchSize is the most inputs the embeddings API accepts in one
+// request; larger batch sizes are lowered to it.
+const MaxEmbeddingBatchSize = 2048
+
+// embeddingBatchDelay spaces out consecutive embeddings calls so large loads
+// stay under the deployment's requests-per-minute limit.
+const embeddingBatchDelay = 200 * time.Millisecond
+
+// DefaultEmbeddingConcurrency is the number of embeddings calls
+// GenerateEmbeddingsConcurrent keeps in flight when given zero or less.
+const DefaultEmbeddingConcurrency = 4
+
+// EmbeddingOption configures the embeddings requests of GenerateEmbedding and
+// its batch variants.
+type EmbeddingOption func(*azopenai.EmbeddingsOptions)
+
+// WithDimensions asks the model to shorten its vectors to dims dimensions.
+// Only text-embedding-3 models and later accept it; older models reject the
+// request. Shorter vectors shrink the container's vector index at a small
+// cost in accuracy, and the container's vector policy must declare the same
+// dimensions.
+func WithDimensions(dims int) EmbeddingOption {
+	return func(o *azopenai.EmbeddingsOptions) {
+		d := int32(dims)
+		o.Dimensions = &d
+	}
+}
+
+// newEmbeddingsOptions builds the request for embedding texts with
+// deployment.
+func newEmbeddingsOptions(texts []string, deployment string, opts []EmbeddingOption) azopenai.EmbeddingsOptions {
+	o := azopenai.EmbeddingsOptions{
+		Input:          texts,
+		DeploymentName: &deployment,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// GenerateEmbeddingsBatch produces one embedding per input, in input order.
+// Inputs are sent batchSize at a time (at most MaxEmbeddingBatchSize) so a
+// large slice costs a handful of round trips instead of one per string. An
+// error names the range of inputs whose request failed.
+func GenerateEmbeddingsBatch(
+	ctx context.Context,
+	client *azopenai.Client,
+	inputs []string,
+	deployment string,
+	batchSize int,
+	opts ...EmbeddingOption,
+) ([][]float32, error) {
+	batchSize = embeddingBatchSize(batchSize)
+
+	embeddings := make([][]float32, len(inputs))
+	for start := 0; start < len(inputs); start += batchSize {
+		if start > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(embeddingBatchDelay):
+			}
+		}
+
+		end := min(start+batchSize, len(inputs))
+		batch, err := embedBatch(ctx, client, inputs[start:end], deployment, opts)
+		if err != nil {
+			return nil, fmt.Errorf("inputs %d-%d: %w", start, end-1, err)
+		}
+		copy(embeddings[start:end], batch)
+	}
+
+	return embeddings, nil
+}
+
+// estimatedCallLatency is the typical duration of one embeddings call, used
+// by EstimateEmbeddingTime.
+const estimatedCallLatency = 500 * time.Millisecond
+
+// EstimateEmbeddingTime estimates the number of calls GenerateEmbeddingsConcurrent
+// makes for inputs texts totalling tokens, and how long they take with
+// concurrency calls in flight against a deployment limited to
+// tokensPerMinute. The estimate is whichever is slower: the calls at a typical
+// latency, or the tokens at the rate limit. Zero or less for batchSize or
+// concurrency uses the default; zero tokensPerMinute means no limit.
+func EstimateEmbeddingTime(inputs, tokens, batchSize, concurrency, tokensPerMinute int) (int, time.Duration) {
+	batchSize = embeddingBatchSize(batchSize)
+	if concurrency <= 0 {
+		concurrency = DefaultEmbeddingConcurrency
+	}
+
+	calls := (inputs + batchSize - 1) / batchSize
+	rounds := (calls + concurrency - 1) / concurrency
+	d := time.Duration(rounds) * estimatedCallLatency
+	if tokensPerMinute > 0 {
+		d = max(d, time.Duration(float64(tokens)/float64(tokensPerMinute)*float64(time.Minute)))
+	}
+	return calls, d
+}
+
+// GenerateEmbeddingsConcurrent produces one embedding per input, in input
+// order, like GenerateEmbeddingsBatch, but keeps up to concurrency batches in
+// flight at once. It does not retry on its own: throttled requests are
+// retried by the client's retry policy, which honors the service's
+// Retry-After header, so build the client with client.WithRetry allowing
+// enough attempts for large loads. When a batch still fails the remaining
+// batches are cancelled, and the errors of every failed batch are returned
+// together.
+func GenerateEmbeddingsConcurrent(
+	ctx context.Context,
+	client *azopenai.Client,
+	inputs []string,
+	deployment string,
+	batchSize int,
+	concurrency int,
+	opts ...EmbeddingOption,
+) ([][]float32, error) {
+	return embedConcurrently(ctx, inputs, batchSize, concurrency, func(ctx context.Context, texts []string) ([][]float32, error) {
+		return embedBatch(ctx, client, texts, deployment, opts)
+	})
+}
+
+// embedConcurrently splits inputs into batches and runs embed on them from a
+// pool of concurrency workers, writing each result at its batch's offset.
+func embedConcurrently(
+	ctx context.Context,
+	inputs []string,
+	batchSize int,
+	concurrency int,
+	embed func(ctx context.Context, texts []string) ([][]float32, error),
+) ([][]float32, error) {
+	batchSize = embeddingBatchSize(batchSize)
+	if concurrency <= 0 {
+		concurrency = DefaultEmbeddingConcurrency
+	}
+
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	embeddings := make([][]float32, len(inputs))
+	starts := make(chan int)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	batches := (len(inputs) + batchSize - 1) / batchSize
+	for range min(concurrency, batches) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range starts {
+				end := min(start+batchSize, len(inputs))
+				batch, err := embed(workCtx, inputs[start:end])
+				if err != nil {
+					// Batches interrupted because another one failed are not
+					// failures of their own.
+					if workCtx.Err() == nil || !errors.Is(err, context.Canceled) {
+						mu.Lock()
+						errs = append(errs, fmt.Errorf("inputs %d-%d: %w", start, end-1, err))
+						mu.Unlock()
+					}
+					cancel()
+					continue
+				}
+				copy(embeddings[start:end], batch)
+			}
+		}()
+	}
+
+feed:
+	for start := 0; start < len(inputs); start += batchSize {
+		select {
+		case starts <- start:
+		case <-workCtx.Done():
+			break feed
+		}
+	}
+	close(starts)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// embeddingBatchSize returns the batch size to use for a requested one:
+// DefaultEmbeddingBatchSize for zero or less, and at most
+// MaxEmbeddingBatchSize.
+func embeddingBatchSize(requested int) int {
+	if requested <= 0 {
+		return DefaultEmbeddingBatchSize
+	}
+	return min(requested, MaxEmbeddingBatchSize)
+}
+
+// embedBatch sends one embeddings request for texts and returns the vectors
+// in input order.
+func embedBatch(ctx context.Context, client *azopenai.Client, texts []string, deployment string, opts []EmbeddingOption) ([][]float32, error) {
+	resp, err := client.GetEmbeddings(ctx, newEmbeddingsOptions(texts, deployment, opts), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embeddings: %w", ClassifyError(err))
+	}
+	recordEmbeddingUsage(ctx, resp.Usage)
+
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+
+	// The service reports each item's position in the request; use it
+	// rather than assuming the response preserves order.
+	embeddings := make([][]float32, len(texts))
+	for i, item := range resp.Data {
+		idx := i
+		if item.Index != nil {
+			idx = int(*item.Index)
+		}
+		if idx < 0 || idx >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range for batch of %d", idx, len(texts))
+		}
+		embeddings[idx] = item.Embedding
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,268 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// numberInputs returns the inputs "0", "1", ... "n-1".
+func numberInputs(n int) []string {
+	inputs := make([]string, n)
+	for i := range inputs {
+		inputs[i] = strconv.Itoa(i)
+	}
+	return inputs
+}
+
+// checkEchoed fails the test unless embeddings[i] is the vector echoEmbeddings
+// returns for input i.
+func checkEchoed(t *testing.T, embeddings [][]float32, n int) {
+	t.Helper()
+	if len(embeddings) != n {
+		t.Fatalf("got %d embeddings, want %d", len(embeddings), n)
+	}
+	for i, e := range embeddings {
+		if len(e) != 1 || e[0] != float32(i) {
+			t.Fatalf("embedding %d = %v, want [%d]", i, e, i)
+		}
+	}
+}
+
+func TestGenerateEmbeddingsBatchChunks(t *testing.T) {
+	var sizes []int
+	client := newFakeOpenAIClient(t, func(req *http.Request) (*http.Response, error) {
+		body, err := readEmbeddingsRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, len(body.Input))
+		return echoEmbeddings(req, body)
+	})
+
+	embeddings, err := GenerateEmbeddingsBatch(context.Background(), client, numberInputs(5), "test-deployment", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, embeddings, 5)
+	if want := []int{2, 2, 1}; !slices.Equal(sizes, want) {
+		t.Errorf("request sizes = %v, want %v", sizes, want)
+	}
+}
+
+func TestGenerateEmbeddingsConcurrentChunks(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	client := newFakeOpenAIClient(t, func(req *http.Request) (*http.Response, error) {
+		body, err := readEmbeddingsRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		sizes = append(sizes, len(body.Input))
+		mu.Unlock()
+		return echoEmbeddings(req, body)
+	})
+
+	embeddings, err := GenerateEmbeddingsConcurrent(context.Background(), client, numberInputs(7), "test-deployment", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, embeddings, 7)
+	slices.Sort(sizes)
+	if want := []int{1, 3, 3}; !slices.Equal(sizes, want) {
+		t.Errorf("request sizes = %v, want %v", sizes, want)
+	}
+}
+
+func TestGenerateEmbeddingsConcurrentLimitsInFlight(t *testing.T) {
+	const concurrency = 3
+	var inFlight, maxInFlight atomic.Int32
+	client := newFakeOpenAIClient(t, func(req *http.Request) (*http.Response, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		body, err := readEmbeddingsRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		// Hold the request long enough for the other workers to start theirs.
+		time.Sleep(20 * time.Millisecond)
+		return echoEmbeddings(req, body)
+	})
+
+	embeddings, err := GenerateEmbeddingsConcurrent(context.Background(), client, numberInputs(20), "test-deployment", 2, concurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, embeddings, 20)
+	if m := maxInFlight.Load(); m <= 1 || m > concurrency {
+		t.Errorf("max requests in flight = %d, want between 2 and %d", m, concurrency)
+	}
+}
+
+func TestGenerateEmbeddingsConcurrentRetriesThrottledBatch(t *testing.T) {
+	var throttled atomic.Bool
+	transport := fakeOpenAI(func(req *http.Request) (*http.Response, error) {
+		body, err := readEmbeddingsRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		if body.Input[0] == "4" && throttled.CompareAndSwap(false, true) {
+			resp, err := jsonResponse(req, http.StatusTooManyRequests, map[string]any{"error": map[string]any{"code": "429", "message": "rate limit"}})
+			if err == nil {
+				resp.Header.Set("Retry-After", "0")
+			}
+			return resp, err
+		}
+		return echoEmbeddings(req, body)
+	})
+	// The retry policy client.WithRetry(3, 0, time.Second) installs.
+	client, err := azopenai.NewClientWithKeyCredential("https://fake.openai.azure.com/", azcore.NewKeyCredential("test-key"),
+		&azopenai.ClientOptions{ClientOptions: azcore.ClientOptions{
+			Transport: transport,
+			Retry:     policy.RetryOptions{MaxRetries: 2, RetryDelay: time.Nanosecond, MaxRetryDelay: time.Second},
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embeddings, err := GenerateEmbeddingsConcurrent(context.Background(), client, numberInputs(8), "test-deployment", 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !throttled.Load() {
+		t.Fatal("no batch was throttled")
+	}
+	checkEchoed(t, embeddings, 8)
+}
+
+func TestGenerateEmbeddingsBatchReportsFailedRange(t *testing.T) {
+	calls := 0
+	client := newFakeOpenAIClient(t, func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 2 {
+			return jsonResponse(req, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": "BadRequest", "message": "bad input"}})
+		}
+		body, err := readEmbeddingsRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		return echoEmbeddings(req, body)
+	})
+
+	_, err := GenerateEmbeddingsBatch(context.Background(), client, numberInputs(5), "test-deployment", 2)
+	if err == nil {
+		t.Fatal("GenerateEmbeddingsBatch succeeded despite a failed request")
+	}
+	if !strings.HasPrefix(err.Error(), "inputs 2-3: ") {
+		t.Errorf("error = %q, want it to name inputs 2-3", err)
+	}
+}
+
+// blockingOpenAI returns a transport that signals on started when a request
+// arrives and then blocks until the request's context is done.
+func blockingOpenAI(started chan<- struct{}) fakeOpenAI {
+	return func(req *http.Request) (*http.Response, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+}
+
+func TestEmbeddingsCancelledMidFlight(t *testing.T) {
+	calls := map[string]func(ctx context.Context, client *azopenai.Client) error{
+		"GenerateEmbedding": func(ctx context.Context, client *azopenai.Client) error {
+			_, err := GenerateEmbedding(ctx, client, "1", "test-deployment")
+			return err
+		},
+		"GenerateEmbeddingsConcurrent": func(ctx context.Context, client *azopenai.Client) error {
+			_, err := GenerateEmbeddingsConcurrent(ctx, client, numberInputs(10), "test-deployment", 2, 3)
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			started := make(chan struct{}, 1)
+			client := newFakeOpenAIClient(t, blockingOpenAI(started))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- call(ctx, client) }()
+
+			<-started
+			cancel()
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("err = %v, want context.Canceled", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("call did not return within 1s of cancellation")
+			}
+		})
+	}
+}
+
+func TestEmbedConcurrentlySplitsAtMaxBatchSize(t *testing.T) {
+	tests := []struct {
+		inputs, batchSize int
+		want              []int // sorted request sizes
+	}{
+		{MaxEmbeddingBatchSize, MaxEmbeddingBatchSize, []int{MaxEmbeddingBatchSize}},
+		{MaxEmbeddingBatchSize + 1, MaxEmbeddingBatchSize, []int{1, MaxEmbeddingBatchSize}},
+		// Larger batch sizes are lowered to the API's limit.
+		{MaxEmbeddingBatchSize + 1, MaxEmbeddingBatchSize + 500, []int{1, MaxEmbeddingBatchSize}},
+		{2*MaxEmbeddingBatchSize + 1, 2 * MaxEmbeddingBatchSize, []int{1, MaxEmbeddingBatchSize, MaxEmbeddingBatchSize}},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%d inputs, batch size %d", tc.inputs, tc.batchSize), func(t *testing.T) {
+			var mu sync.Mutex
+			var sizes []int
+			embed := func(_ context.Context, texts []string) ([][]float32, error) {
+				mu.Lock()
+				sizes = append(sizes, len(texts))
+				mu.Unlock()
+				vectors := make([][]float32, len(texts))
+				for i, text := range texts {
+					n, err := strconv.Atoi(text)
+					if err != nil {
+						return nil, err
+					}
+					vectors[i] = []float32{float32(n)}
+				}
+				return vectors, nil
+			}
+
+			embeddings, err := embedConcurrently(context.Background(), numberInputs(tc.inputs), tc.batchSize, 4, embed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEchoed(t, embeddings, tc.inputs)
+			slices.Sort(sizes)
+			if !slices.Equal(sizes, tc.want) {
+				t.Errorf("batch sizes = %v, want %v", sizes, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// Errors returned by service calls are wrapped with one of these sentinels
+// when the cause is recognized, so callers can branch with errors.Is instead of
+// inspecting status codes. The original *azcore.ResponseError stays in the
+// chain for errors.As.
+var (
+	// ErrThrottled means the service returned 429 Too Many Requests after the
+	// SDK's own retries: the container's throughput or the deployment's
+	// quota is exhausted.
+	ErrThrottled = errors.New("request throttled")
+	// ErrAuth means the credential was rejected (401) or lacks a role
+	// assignment for the operation (403).
+	ErrAuth = errors.New("authentication or authorization failed")
+	// ErrContainerNotFound means the database or container does not exist.
+	// A missing document is not classified.
+	ErrContainerNotFound = errors.New("database or container not found")
+	// ErrDeploymentNotFound means Azure OpenAI has no deployment of the
+	// requested name at the endpoint.
+	ErrDeploymentNotFound = errors.New("deployment not found")
+	// ErrIndexNotFound means the query needs an index the container does not
+	// have, such as a full-text index for FullTextScore or a vector index for
+	// VectorDistance.
+	ErrIndexNotFound = errors.New("required index not found")
+	// ErrTimeout means the operation did not finish within its deadline,
+	// such as the one set by WithTimeout.
+	ErrTimeout = errors.New("operation timed out")
+)
+
+// cosmosSubstatusOwnerNotFound is the x-ms-substatus Cosmos DB returns with
+// a 404 when the database or container of the addressed resource is missing.
+const cosmosSubstatusOwnerNotFound = "1003"
+
+// ClassifyError wraps err with the sentinel error matching its service
+// response or expired deadline, or returns it unchanged when the cause is not
+// recognized. Not-found and bad-request responses are told apart by the
+// service that sent them, Cosmos DB or Azure OpenAI, and by what the request
+// addressed.
+func ClassifyError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+
+	switch respErr.StatusCode {
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %w", ErrThrottled, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrAuth, err)
+	case http.StatusNotFound:
+		switch {
+		case isOpenAIRequest(respErr):
+			return fmt.Errorf("%w: %w", ErrDeploymentNotFound, err)
+		case isCosmosRequest(respErr) && cosmosContainerMissing(respErr):
+			return fmt.Errorf("%w: %w", ErrContainerNotFound, err)
+		}
+	case http.StatusBadRequest:
+		// Cosmos DB reports a missing index as a generic bad request to a
+		// query, with no substatus of its own; the message is the only place
+		// the cause appears.
+		if isCosmosQuery(respErr) && strings.Contains(strings.ToLower(respErr.Error()), "index") {
+			return fmt.Errorf("%w: %w", ErrIndexNotFound, err)
+		}
+	}
+	return err
+}
+
+// requestPath returns the URL path of the request that failed, or "" when
+// the error carries no request.
+func requestPath(respErr *azcore.ResponseError) string {
+	if respErr.RawResponse == nil || respErr.RawResponse.Request == nil || respErr.RawResponse.Request.URL == nil {
+		return ""
+	}
+	return respErr.RawResponse.Request.URL.Path
+}
+
+// isCosmosRequest reports whether the failed request went to Cosmos DB, whose
+// resource paths start with /dbs.
+func isCosmosRequest(respErr *azcore.ResponseError) bool {
+	path := requestPath(respErr)
+	return path == "/dbs" || strings.HasPrefix(path, "/dbs/")
+}
+
+// isOpenAIRequest reports whether the failed request went to Azure OpenAI,
+// whose paths start with /openai.
+func isOpenAIRequest(respErr *azcore.ResponseError) bool {
+	return strings.HasPrefix(requestPath(respErr), "/openai/")
+}
+
+// isCosmosQuery reports whether the failed request was a Cosmos DB query.
+func isCosmosQuery(respErr *azcore.ResponseError) bool {
+	return isCosmosRequest(respErr) && strings.EqualFold(respErr.RawResponse.Request.Header.Get("x-ms-documentdb-isquery"), "true")
+}
+
+// cosmosContainerMissing reports whether a Cosmos DB 404 means the database
+// or container is missing: either the substatus says the owner of the
+// addressed resource is gone, or the request addressed a database or
+// container itself (/dbs/{db} or /dbs/{db}/colls/{coll}) rather than a
+// document in it.
+func cosmosContainerMissing(respErr *azcore.ResponseError) bool {
+	if respErr.RawResponse.Header.Get("x-ms-substatus") == cosmosSubstatusOwnerNotFound {
+		return true
+	}
+	segments := strings.Split(strings.Trim(requestPath(respErr), "/"), "/")
+	return len(segments) == 2 || (len(segments) == 4 && segments[2] == "colls")
+}
@@ -0,0 +1,76 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// responseError returns the error the SDK builds for a failed request with
+// the given method, URL path, status, headers, and body.
+func responseError(method, path string, status int, header http.Header, body string) error {
+	req := &http.Request{Method: method, URL: &url.URL{Scheme: "https", Host: "example.azure.com", Path: path}, Header: http.Header{}}
+	if strings.HasSuffix(path, "/docs") && method == http.MethodPost {
+		req.Header.Set("x-ms-documentdb-isquery", "True")
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+	return runtime.NewResponseError(resp)
+}
+
+func TestClassifyError(t *testing.T) {
+	substatus := func(s string) http.Header { return http.Header{"X-Ms-Substatus": []string{s}} }
+
+	tests := []struct {
+		name string
+		err  error
+		want error // nil: left unclassified
+	}{
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), ErrTimeout},
+		{"throttled", responseError(http.MethodPost, "/dbs/db/colls/c/docs", 429, nil, `{"code":"TooManyRequests"}`), ErrThrottled},
+		{"unauthorized", responseError(http.MethodPost, "/openai/deployments/d/embeddings", 401, nil, `{}`), ErrAuth},
+		{"forbidden", responseError(http.MethodGet, "/dbs/db/colls/c", 403, nil, `{}`), ErrAuth},
+		{"container read 404", responseError(http.MethodGet, "/dbs/db/colls/c", 404, substatus("0"), `{"code":"NotFound"}`), ErrContainerNotFound},
+		{"database read 404", responseError(http.MethodGet, "/dbs/db", 404, nil, `{"code":"NotFound"}`), ErrContainerNotFound},
+		{"query in missing container", responseError(http.MethodPost, "/dbs/db/colls/c/docs", 404, substatus("1003"), `{"code":"NotFound"}`), ErrContainerNotFound},
+		{"missing document", responseError(http.MethodGet, "/dbs/db/colls/c/docs/42", 404, substatus("0"), `{"code":"NotFound"}`), nil},
+		{"missing deployment", responseError(http.MethodPost, "/openai/deployments/d/embeddings", 404, nil,
+			`{"error":{"code":"DeploymentNotFound","message":"The API deployment for this resource does not exist."}}`), ErrDeploymentNotFound},
+		{"query without index", responseError(http.MethodPost, "/dbs/db/colls/c/docs", 400, nil,
+			`{"code":"BadRequest","message":"FullTextScore requires a full text index on /Description."}`), ErrIndexNotFound},
+		{"other bad query", responseError(http.MethodPost, "/dbs/db/colls/c/docs", 400, nil,
+			`{"code":"BadRequest","message":"Syntax error near 'FROM'."}`), nil},
+		{"openai bad request naming an index", responseError(http.MethodPost, "/openai/deployments/d/embeddings", 400, nil,
+			`{"error":{"code":"BadRequest","message":"Invalid value at index 3 of input."}}`), nil},
+		{"not a service error", errors.New("boom"), nil},
+	}
+
+	sentinels := []error{ErrTimeout, ErrThrottled, ErrAuth, ErrContainerNotFound, ErrDeploymentNotFound, ErrIndexNotFound}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyError(tt.err)
+			for _, sentinel := range sentinels {
+				if errors.Is(got, sentinel) != (sentinel == tt.want) {
+					t.Errorf("errors.Is(%v, %v) = %v", got, sentinel, !(sentinel == tt.want))
+				}
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("classified error %v no longer wraps the original", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// ExplainResult describes how Cosmos DB executed a vector search query.
+type ExplainResult struct {
+	Query         string
+	ResultCount   int
+	RequestCharge float64
+	// Duration is the client-observed time for all pages, network included.
+	Duration time.Duration
+	// ServerTimeMs is the service's total execution time, when it reports one.
+	ServerTimeMs float64
+	// IndexMetrics is the index utilization report: which indexes the query
+	// used and which ones would have helped.
+	IndexMetrics string
+	// QueryMetrics is the raw semicolon-separated query metrics, when present.
+	QueryMetrics string
+}
+
+// ExplainVectorSearch runs the same query as ExecuteVectorSearch with index
+// metrics enabled and reports how it executed instead of the rows. Use it to
+// confirm the vector index is being used, for example right after creating a
+// container when the index may still be building.
+func ExplainVectorSearch(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	opts ...SearchOption,
+) (*ExplainResult, error) {
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	queryText, params, err := buildVectorQuery(embedding, embeddedField, distanceFunction, options)
+	if err != nil {
+		return nil, err
+	}
+
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager(queryText, pk, &azcosmos.QueryOptions{
+		QueryParameters:      params,
+		PopulateIndexMetrics: true,
+	})
+
+	result := &ExplainResult{Query: queryText}
+	var indexMetrics, queryMetrics []string
+	start := time.Now()
+
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("query failed: %w", ClassifyError(err))
+		}
+
+		result.ResultCount += len(resp.Items)
+		result.RequestCharge += float64(resp.RequestCharge)
+		if resp.IndexMetrics != nil && *resp.IndexMetrics != "" {
+			indexMetrics = append(indexMetrics, *resp.IndexMetrics)
+		}
+		if resp.QueryMetrics != nil && *resp.QueryMetrics != "" {
+			queryMetrics = append(queryMetrics, *resp.QueryMetrics)
+			result.ServerTimeMs += totalExecutionTimeMs(*resp.QueryMetrics)
+		}
+	}
+
+	result.Duration = time.Since(start)
+	result.IndexMetrics = strings.Join(indexMetrics, "\n")
+	result.QueryMetrics = strings.Join(queryMetrics, "\n")
+	return result, nil
+}
+
+// Summary returns a one-line description of the explain result.
+func (e *ExplainResult) Summary() string {
+	summary := fmt.Sprintf("%d results, %.2f RUs, %s", e.ResultCount, e.RequestCharge, e.Duration.Round(time.Millisecond))
+	if e.ServerTimeMs > 0 {
+		summary += fmt.Sprintf(" (server %.2f ms)", e.ServerTimeMs)
+	}
+	return summary
+}
+
+// totalExecutionTimeMs extracts totalExecutionTimeInMs from a query metrics
+// string such as "totalExecutionTimeInMs=1.23;queryCompileTimeInMs=0.05;...".
+func totalExecutionTimeMs(metrics string) float64 {
+	for _, pair := range strings.Split(metrics, ";") {
+		key, value, ok := strings.Cut(pair, "=")
+		if ok && key == "totalExecutionTimeInMs" {
+			ms, err := strconv.ParseFloat(value, 64)
+			if err == nil {
+				return ms
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+)
+
+// ExplainedResult is a search result with a one-sentence justification of
+// why it matches the query.
+type ExplainedResult struct {
+	QueryResult
+	// Explanation is empty when the model gave none for this result.
+	Explanation string
+}
+
+// GenerationConfig sets the sampling parameters of a chat call. Nil fields
+// and an empty Stop leave the service default.
+type GenerationConfig struct {
+	Temperature *float32
+	TopP        *float32
+	MaxTokens   *int32
+	// Seed asks the service for reproducible output, on a best-effort basis.
+	Seed *int64
+	Stop []string
+}
+
+// DefaultExplanationConfig returns the generation settings ExplainResults
+// uses unless overridden: temperature 0, so the same results get the same
+// explanations from run to run, and enough tokens for one sentence per
+// result without truncation.
+func DefaultExplanationConfig() GenerationConfig {
+	temperature := float32(0)
+	maxTokens := int32(1000)
+	return GenerationConfig{Temperature: &temperature, MaxTokens: &maxTokens}
+}
+
+// apply copies the set parameters onto a chat request.
+func (g GenerationConfig) apply(opts *azopenai.ChatCompletionsOptions) {
+	opts.Temperature = g.Temperature
+	opts.TopP = g.TopP
+	opts.MaxTokens = g.MaxTokens
+	opts.Seed = g.Seed
+	if len(g.Stop) > 0 {
+		opts.Stop = g.Stop
+	}
+}
+
+// explanationPrompt instructs the chat model to answer with a JSON object
+// that maps each hotel ID to one sentence.
+const explanationPrompt = `You explain hotel search results. For each hotel in the user's message, write one sentence saying why it matches the search query, based only on the hotel's description. Answer with a JSON object of the form {"explanations": {"<hotel id>": "<sentence>"}} with one entry per hotel.`
+
+// ErrStopWithJSON means a GenerationConfig with stop sequences was given for
+// a call that must answer in JSON, which a stop sequence would cut short.
+var ErrStopWithJSON = errors.New("stop sequences cannot be used with a JSON response")
+
+// ExplainResults asks the chat deployment, in a single call, why each result
+// matches queryText, and returns the results with their explanations in the
+// same order. gen sets the sampling parameters; see
+// DefaultExplanationConfig. gen.Stop must be empty, since the model answers
+// in JSON and a stop sequence (such as the "." ending a sentence) would end
+// the answer before the object is closed; ErrStopWithJSON is returned
+// otherwise. A result the model did not explain keeps an empty Explanation
+// and is logged; an error is returned only when the call fails or the
+// response is not the expected JSON.
+func ExplainResults(ctx context.Context, client *azopenai.Client, deployment, queryText string, results []QueryResult, gen GenerationConfig) ([]ExplainedResult, error) {
+	explained := make([]ExplainedResult, len(results))
+	for i, r := range results {
+		explained[i] = ExplainedResult{QueryResult: r}
+	}
+	if len(gen.Stop) > 0 {
+		return explained, fmt.Errorf("failed to generate explanations: %w", ErrStopWithJSON)
+	}
+	if len(results) == 0 {
+		return explained, nil
+	}
+	if client == nil {
+		return explained, fmt.Errorf("failed to generate explanations: no Azure OpenAI client; set AZURE_OPENAI_EMBEDDING_ENDPOINT")
+	}
+
+	var user strings.Builder
+	fmt.Fprintf(&user, "Search query: %s\n\nHotels:\n", queryText)
+	for _, r := range results {
+		fmt.Fprintf(&user, "- id: %s\n  name: %s\n  description: %s\n", r.ID, r.HotelName, r.Description)
+	}
+
+	opts := azopenai.ChatCompletionsOptions{
+		Messages: []azopenai.ChatRequestMessageClassification{
+			&azopenai.ChatRequestSystemMessage{Content: azopenai.NewChatRequestSystemMessageContent(explanationPrompt)},
+			&azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent(user.String())},
+		},
+		DeploymentName: &deployment,
+		ResponseFormat: &azopenai.ChatCompletionsJSONResponseFormat{},
+	}
+	gen.apply(&opts)
+	resp, err := client.GetChatCompletions(ctx, opts, nil)
+	if err != nil {
+		return explained, fmt.Errorf("failed to generate explanations: %w", ClassifyError(err))
+	}
+	recordChatUsage(ctx, resp.Usage)
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil || resp.Choices[0].Message.Content == nil {
+		return explained, fmt.Errorf("failed to generate explanations: empty response")
+	}
+
+	var parsed struct {
+		Explanations map[string]string `json:"explanations"`
+	}
+	if err := json.Unmarshal([]byte(*resp.Choices[0].Message.Content), &parsed); err != nil {
+		if fr := resp.Choices[0].FinishReason; fr != nil && *fr == azopenai.CompletionsFinishReasonTokenLimitReached {
+			return explained, fmt.Errorf("failed to parse explanations: the response was cut off at the token limit; raise MaxTokens")
+		}
+		return explained, fmt.Errorf("failed to parse explanations: %w", err)
+	}
+
+	var missing []string
+	for i := range explained {
+		explanation := strings.TrimSpace(parsed.Explanations[explained[i].ID])
+		if explanation == "" {
+			missing = append(missing, explained[i].ID)
+		}
+		explained[i].Explanation = explanation
+	}
+	if len(missing) > 0 {
+		slog.WarnContext(ctx, "model did not explain every result", slog.Any("hotelIDs", missing))
+	}
+	return explained, nil
+}
+
+// PrintExplanations outputs why each result matched, skipping results the
+// model did not explain.
+func PrintExplanations(results []ExplainedResult) {
+	fmt.Println("--- Why these hotels ---")
+	for i, r := range results {
+		if r.Explanation != "" {
+			fmt.Printf("%d. %s: %s\n", i+1, r.HotelName, r.Explanation)
+		}
+	}
+	fmt.Println()
+}
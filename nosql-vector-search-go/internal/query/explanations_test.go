@@ -0,0 +1,105 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExplainResultsWithoutClient(t *testing.T) {
+	results := []QueryResult{{ID: "1", HotelName: "Stay Inn"}}
+	explained, err := ExplainResults(context.Background(), nil, "chat", "beach", results, DefaultExplanationConfig())
+	if err == nil {
+		t.Fatal("ExplainResults with a nil client returned no error")
+	}
+	if len(explained) != 1 || explained[0].ID != "1" || explained[0].Explanation != "" {
+		t.Errorf("explained = %+v, want the result unexplained", explained)
+	}
+}
+
+// chatRequest is the part of a chat completions request body the tests read.
+type chatRequest struct {
+	Temperature    *float32 `json:"temperature"`
+	TopP           *float32 `json:"top_p"`
+	MaxTokens      *int32   `json:"max_tokens"`
+	Seed           *int64   `json:"seed"`
+	Stop           []string `json:"stop"`
+	ResponseFormat struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+}
+
+func TestExplainResultsSendsGenerationConfig(t *testing.T) {
+	var sent chatRequest
+	client := newFakeOpenAIClient(t, func(req *http.Request) (*http.Response, error) {
+		if err := json.NewDecoder(req.Body).Decode(&sent); err != nil {
+			return nil, err
+		}
+		return jsonResponse(req, http.StatusOK, map[string]any{
+			"id": "chat", "object": "chat.completion", "created": 0,
+			"choices": []map[string]any{{
+				"index":         0,
+				"finish_reason": "stop",
+				"message":       map[string]any{"role": "assistant", "content": `{"explanations": {"1": "It is on the beach."}}`},
+			}},
+			"usage": map[string]any{"prompt_tokens": 50, "completion_tokens": 10, "total_tokens": 60},
+		})
+	})
+
+	gen := DefaultExplanationConfig()
+	topP, seed := float32(0.5), int64(42)
+	gen.TopP, gen.Seed = &topP, &seed
+	usage := &Usage{}
+	ctx := WithUsage(context.Background(), usage)
+	explained, err := ExplainResults(ctx, client, "chat", "beach", []QueryResult{{ID: "1"}, {ID: "2"}}, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.Temperature == nil || *sent.Temperature != 0 || sent.TopP == nil || *sent.TopP != 0.5 ||
+		sent.MaxTokens == nil || *sent.MaxTokens != 1000 || sent.Seed == nil || *sent.Seed != 42 {
+		t.Errorf("request sampling parameters = %+v, want temperature 0, top_p 0.5, max_tokens 1000, seed 42", sent)
+	}
+	if sent.ResponseFormat.Type != "json_object" || sent.Stop != nil {
+		t.Errorf("request response format %q and stop %q, want json_object and none", sent.ResponseFormat.Type, sent.Stop)
+	}
+	if explained[0].Explanation != "It is on the beach." || explained[1].Explanation != "" {
+		t.Errorf("explanations = %q, %q", explained[0].Explanation, explained[1].Explanation)
+	}
+	if got := usage.Report(); got.ChatPromptTokens != 50 || got.ChatCompletionTokens != 10 {
+		t.Errorf("usage = %+v, want 50 prompt and 10 completion tokens", got)
+	}
+}
+
+func TestExplainResultsRejectsStop(t *testing.T) {
+	gen := DefaultExplanationConfig()
+	gen.Stop = []string{"."}
+	client := newFakeOpenAIClient(t, func(req *http.Request) (*http.Response, error) {
+		t.Error("ExplainResults called the service despite a stop sequence")
+		return jsonResponse(req, http.StatusInternalServerError, nil)
+	})
+	_, err := ExplainResults(context.Background(), client, "chat", "beach", []QueryResult{{ID: "1"}}, gen)
+	if !errors.Is(err, ErrStopWithJSON) {
+		t.Errorf("ExplainResults = %v, want ErrStopWithJSON", err)
+	}
+}
+
+func TestExplanationPrompt(t *testing.T) {
+	if strings.TrimSpace(explanationPrompt) == "" {
+		t.Fatal("explanationPrompt is empty")
+	}
+	// The prompt is sent as is, not rendered as a template.
+	for _, bad := range []string{"{{", "TODO"} {
+		if strings.Contains(explanationPrompt, bad) {
+			t.Errorf("explanationPrompt contains %q", bad)
+		}
+	}
+	// The service rejects the JSON response format unless a message asks
+	// for JSON.
+	if !strings.Contains(explanationPrompt, "JSON") {
+		t.Error("explanationPrompt does not mention JSON")
+	}
+}
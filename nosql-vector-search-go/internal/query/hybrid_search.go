@@ -0,0 +1,231 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// Search modes accepted by SEARCH_MODE.
+const (
+	SearchModeVector = "vector"
+	SearchModeText   = "text"
+	SearchModeHybrid = "hybrid"
+)
+
+// rrfK is the rank constant of reciprocal rank fusion. 60 is the value from
+// the original RRF paper and the one most search engines default to.
+const rrfK = 60
+
+// HybridResult is a document found by ExecuteHybridSearch, with its position
+// in each ranked list and the fused score used to order the final results.
+type HybridResult struct {
+	QueryResult
+	VectorRank int // 1-based rank in the vector results; 0 if not found there
+	TextRank   int // 1-based rank in the full-text results; 0 if not found there
+	FusedScore float64
+}
+
+// ExtractSearchTerms splits free text into lowercase keywords for
+// FullTextScore, dropping punctuation and duplicate words.
+func ExtractSearchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	var terms []string
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// ExecuteTextSearch ranks documents by full-text relevance of HotelName and
+// Description to the given terms. It requires a full-text policy and
+// full-text indexes on both paths. Returns the result rows and the total
+// request charge.
+func ExecuteTextSearch(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	terms []string,
+	opts ...SearchOption,
+) ([]QueryResult, float64, error) {
+	if len(terms) == 0 {
+		return nil, 0, fmt.Errorf("text search needs at least one search term")
+	}
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx, cancel := options.withTimeout(ctx)
+	defer cancel()
+
+	// Terms are passed as parameters rather than spliced into the query text.
+	names := make([]string, len(terms))
+	params := make([]azcosmos.QueryParameter, 0, len(terms)+len(options.filterParameters()))
+	for i, t := range terms {
+		names[i] = fmt.Sprintf("@term%d", i)
+		params = append(params, azcosmos.QueryParameter{Name: names[i], Value: t})
+	}
+	params = append(params, options.filterParameters()...)
+	termList := strings.Join(names, ", ")
+
+	// Chunk documents repeat their hotel's text, so only hotel documents
+	// are ranked.
+	queryText := fmt.Sprintf(
+		"SELECT TOP %d c.id, c.HotelName, c.Description, c.Rating "+
+			"FROM c "+
+			"%s"+
+			"ORDER BY RANK RRF(FullTextScore(c.HotelName, %s), FullTextScore(c.Description, %s))",
+		options.fetchCount(), options.whereClause("NOT IS_DEFINED(c.ParentId)"), termList, termList,
+	)
+
+	fmt.Println("\n--- Executing Full-Text Search Query ---")
+	fmt.Println("Query:", queryText)
+	fmt.Printf("Parameters: %s = %q\n", termList, terms)
+	fmt.Println("----------------------------------------")
+
+	results, charge, err := runQuery(ctx, container, queryText, params)
+	if err != nil {
+		return nil, charge, err
+	}
+	return page(options, results), charge, nil
+}
+
+// ExecuteHybridSearch runs a vector search and a full-text search over the
+// same candidates and merges them with reciprocal rank fusion, so documents
+// that match the query's exact words (a hotel name, for example) are not
+// missed by a purely semantic ranking. The two searches run concurrently.
+// Options apply to both searches; WithHybridAlpha sets how the rankings are
+// weighted, and a search whose weight is zero is not run at all.
+func ExecuteHybridSearch(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	queryText string,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	opts ...SearchOption,
+) ([]HybridResult, float64, error) {
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Each source must rank the skipped documents too; paging is applied to
+	// the fused list, not to the individual rankings.
+	sourceOpts := append(opts[:len(opts):len(opts)], WithSkip(0), WithTop(options.fetchCount()))
+
+	var (
+		wg                         sync.WaitGroup
+		vectorResults, textResults []QueryResult
+		vectorCharge, textCharge   float64
+		vectorErr, textErr         error
+	)
+	if options.HybridAlpha > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vectorResults, vectorCharge, vectorErr = ExecuteVectorSearch(ctx, container, embedding, embeddedField, distanceFunction, sourceOpts...)
+		}()
+	}
+	if options.HybridAlpha < 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			textResults, textCharge, textErr = ExecuteTextSearch(ctx, container, ExtractSearchTerms(queryText), sourceOpts...)
+		}()
+	}
+	wg.Wait()
+
+	charge := vectorCharge + textCharge
+	if vectorErr != nil {
+		return nil, charge, vectorErr
+	}
+	if textErr != nil {
+		return nil, charge, textErr
+	}
+
+	fused := FuseRRF(vectorResults, textResults, options.fetchCount(), options.HybridAlpha)
+	return page(options, fused), charge, nil
+}
+
+// FuseRRF merges two ranked lists with weighted reciprocal rank fusion: a
+// document scores alpha/(60+rank) for its rank in the vector list and
+// (1-alpha)/(60+rank) for its rank in the text list, and the sum orders the
+// result. Documents are matched by id, so each appears once. At most k
+// results are returned.
+func FuseRRF(vectorResults, textResults []QueryResult, k int, alpha float64) []HybridResult {
+	byID := make(map[string]*HybridResult)
+	var order []string
+
+	add := func(r QueryResult, rank int, isVector bool) {
+		h, ok := byID[r.ID]
+		if !ok {
+			h = &HybridResult{QueryResult: r}
+			byID[r.ID] = h
+			order = append(order, r.ID)
+		}
+		if isVector {
+			h.VectorRank = rank
+			// Keep the vector row so SimilarityScore and DistanceFunction survive.
+			h.QueryResult = r
+			h.FusedScore += alpha / float64(rrfK+rank)
+		} else {
+			h.TextRank = rank
+			h.FusedScore += (1 - alpha) / float64(rrfK+rank)
+		}
+	}
+
+	for i, r := range vectorResults {
+		add(r, i+1, true)
+	}
+	for i, r := range textResults {
+		add(r, i+1, false)
+	}
+
+	fused := make([]HybridResult, 0, len(order))
+	for _, id := range order {
+		fused = append(fused, *byID[id])
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].FusedScore > fused[j].FusedScore
+	})
+
+	if len(fused) > k {
+		fused = fused[:k]
+	}
+	return fused
+}
+
+// PrintHybridResults outputs hybrid results with their per-source ranks.
+func PrintHybridResults(results []HybridResult, requestCharge float64) {
+	fmt.Println("\n--- Hybrid Search Results ---")
+	if len(results) == 0 {
+		fmt.Println("No good matches found.")
+		return
+	}
+
+	for i, r := range results {
+		fmt.Printf("%d. %s, Fused score: %.4f (vector rank: %s, text rank: %s)\n",
+			i+1, r.HotelName, r.FusedScore, formatRank(r.VectorRank), formatRank(r.TextRank))
+	}
+
+	fmt.Printf("\nHybrid Search Request Charge: %.2f RUs\n\n", requestCharge)
+}
+
+func formatRank(rank int) string {
+	if rank == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", rank)
+}
@@ -0,0 +1,86 @@
+package query
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHybridOptionsLastWins(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []SearchOption
+		want float64
+	}{
+		{"default", nil, DefaultHybridAlpha},
+		{"alpha", []SearchOption{WithHybridAlpha(0.8)}, 0.8},
+		{"weights are normalized", []SearchOption{WithHybridWeights(1, 3)}, 0.25},
+		{"weights after alpha", []SearchOption{WithHybridAlpha(0.8), WithHybridWeights(1, 3)}, 0.25},
+		{"alpha after weights", []SearchOption{WithHybridWeights(1, 3), WithHybridAlpha(0.8)}, 0.8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := newSearchOptions(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(options.HybridAlpha-tt.want) > 1e-9 {
+				t.Errorf("HybridAlpha = %g, want %g", options.HybridAlpha, tt.want)
+			}
+		})
+	}
+}
+
+func TestHybridWeightsValidation(t *testing.T) {
+	for _, w := range [][2]float64{{-1, 1}, {1, -1}, {0, 0}} {
+		if _, err := newSearchOptions([]SearchOption{WithHybridWeights(w[0], w[1])}); err == nil {
+			t.Errorf("WithHybridWeights(%g, %g) was accepted", w[0], w[1])
+		}
+	}
+	if _, err := newSearchOptions([]SearchOption{WithHybridWeights(0, 1)}); err != nil {
+		t.Errorf("WithHybridWeights(0, 1) = %v, want text-only accepted", err)
+	}
+}
+
+// TestFuseRRFRankingFlips checks that moving weight from the vector ranking
+// to the text ranking changes which document comes first.
+func TestFuseRRFRankingFlips(t *testing.T) {
+	vector := []QueryResult{{ID: "semantic"}, {ID: "both"}, {ID: "brand"}}
+	text := []QueryResult{{ID: "brand"}, {ID: "both"}, {ID: "semantic"}}
+
+	tests := []struct {
+		name                 string
+		vectorW, textW       float64
+		wantFirst, wantThird string
+	}{
+		{"vector only", 1, 0, "semantic", "brand"},
+		{"favor vector", 3, 1, "semantic", "brand"},
+		{"favor text", 1, 3, "brand", "semantic"},
+		{"text only", 0, 1, "brand", "semantic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := newSearchOptions([]SearchOption{WithHybridWeights(tt.vectorW, tt.textW)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fused := FuseRRF(vector, text, 3, options.HybridAlpha)
+			if len(fused) != 3 {
+				t.Fatalf("got %d results, want 3", len(fused))
+			}
+			if fused[0].ID != tt.wantFirst || fused[2].ID != tt.wantThird {
+				t.Errorf("ranking = %s, %s, %s; want %s first and %s last",
+					fused[0].ID, fused[1].ID, fused[2].ID, tt.wantFirst, tt.wantThird)
+			}
+		})
+	}
+
+	// With equal weights, first place in one list and last in the other
+	// beats second place in both, and the tie between the two firsts keeps
+	// vector order.
+	fused := FuseRRF(vector, text, 3, 0.5)
+	if fused[0].VectorRank != 1 || fused[0].TextRank != 3 {
+		t.Errorf("first result ranks = vector %d, text %d; want 1 and 3", fused[0].VectorRank, fused[0].TextRank)
+	}
+}
@@ -0,0 +1,120 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// mmrCandidateMultiplier sets how many candidates MMR chooses from: the
+// search fetches this many times the requested number of results.
+const mmrCandidateMultiplier = 4
+
+// ExecuteMMRSearch returns results chosen by Maximal Marginal Relevance, which
+// balances similarity to the query against similarity to the results already
+// picked, so near-identical hotels don't crowd out the rest of the list.
+// lambda ranges from 0 (diversity only) to 1 (relevance only, the same order
+// as a plain vector search).
+//
+// One query fetches Top×4 candidates with their embeddings; the selection
+// itself happens in Go with no further requests.
+func ExecuteMMRSearch(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	lambda float64,
+	opts ...SearchOption,
+) ([]QueryResult, float64, error) {
+	if lambda < 0 || lambda > 1 {
+		return nil, 0, fmt.Errorf("lambda must be between 0 and 1, got %g", lambda)
+	}
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	candidateOpts := append(opts[:len(opts):len(opts)],
+		WithSkip(0), WithTop(options.fetchCount()*mmrCandidateMultiplier), WithVectors())
+	candidates, charge, err := ExecuteVectorSearch(ctx, container, embedding, embeddedField, distanceFunction, candidateOpts...)
+	if err != nil {
+		return nil, charge, err
+	}
+
+	selected := SelectMMR(embedding, candidates, options.fetchCount(), lambda)
+	if !options.IncludeVectors {
+		for i := range selected {
+			selected[i].Vector = nil
+		}
+	}
+	return page(options, selected), charge, nil
+}
+
+// SelectMMR picks up to k candidates by Maximal Marginal Relevance. At each
+// step it takes the candidate maximizing
+//
+//	lambda*sim(query, d) - (1-lambda)*max(sim(d, s) for s already selected)
+//
+// using cosine similarity. Candidates must carry their Vector.
+func SelectMMR(query []float32, candidates []QueryResult, k int, lambda float64) []QueryResult {
+	relevance := make([]float64, len(candidates))
+	for i, c := range candidates {
+		relevance[i] = CosineSimilarity(query, c.Vector)
+	}
+
+	// maxSim[i] is candidate i's highest similarity to any selected result.
+	maxSim := make([]float64, len(candidates))
+	for i := range maxSim {
+		maxSim[i] = math.Inf(-1)
+	}
+	used := make([]bool, len(candidates))
+
+	var selected []QueryResult
+	for len(selected) < k && len(selected) < len(candidates) {
+		best := -1
+		bestScore := math.Inf(-1)
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			score := lambda * relevance[i]
+			if len(selected) > 0 {
+				score -= (1 - lambda) * maxSim[i]
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		used[best] = true
+		selected = append(selected, candidates[best])
+		for i := range candidates {
+			if !used[i] {
+				maxSim[i] = max(maxSim[i], CosineSimilarity(candidates[i].Vector, candidates[best].Vector))
+			}
+		}
+	}
+	return selected
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0 when
+// the vectors differ in length or either has zero magnitude.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,228 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// maxConcurrentSearches bounds how many queries ExecuteMultiVectorSearch runs
+// at once, so a long list of reformulations doesn't burst the container's
+// provisioned throughput.
+const maxConcurrentSearches = 4
+
+// ExecuteMultiVectorSearch runs one vector search per embedding, for example
+// several rephrasings of the same question embedded with
+// GenerateEmbeddingsBatch, and merges them into a single ranking. Each hotel
+// keeps the best score any of the searches gave it. Searches run concurrently,
+// at most four at a time, and options apply to every search. Returns the
+// merged results and the total request charge.
+func ExecuteMultiVectorSearch(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	embeddings [][]float32,
+	embeddedField string,
+	distanceFunction string,
+	opts ...SearchOption,
+) ([]QueryResult, float64, error) {
+	if len(embeddings) == 0 {
+		return nil, 0, fmt.Errorf("multi-vector search needs at least one embedding")
+	}
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Paging applies to the merged ranking, so every search must return the
+	// skipped documents too.
+	searchOpts := append(opts[:len(opts):len(opts)], WithSkip(0), WithTop(options.fetchCount()))
+
+	results := make([][]QueryResult, len(embeddings))
+	charges := make([]float64, len(embeddings))
+	errs := make([]error, len(embeddings))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentSearches)
+	for i, embedding := range embeddings {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], charges[i], errs[i] = ExecuteVectorSearch(ctx, container, embedding, embeddedField, distanceFunction, searchOpts...)
+		}()
+	}
+	wg.Wait()
+
+	var totalCharge float64
+	for i := range embeddings {
+		totalCharge += charges[i]
+		if errs[i] != nil {
+			return nil, totalCharge, fmt.Errorf("search %d of %d: %w", i+1, len(embeddings), errs[i])
+		}
+	}
+
+	merged := mergeBestScore(results, distanceFunction)
+	if len(merged) > options.fetchCount() {
+		merged = merged[:options.fetchCount()]
+	}
+	return page(options, merged), totalCharge, nil
+}
+
+// mergeBestScore combines ranked result lists, keeping each document once
+// with the best score it received, and orders the result best first.
+func mergeBestScore(lists [][]QueryResult, distanceFunction string) []QueryResult {
+	higherIsBetter := HigherIsBetter(distanceFunction)
+	better := func(a, b float64) bool {
+		if higherIsBetter {
+			return a > b
+		}
+		return a < b
+	}
+
+	byID := make(map[string]int)
+	var merged []QueryResult
+	for _, list := range lists {
+		for _, r := range list {
+			i, ok := byID[r.ID]
+			if !ok {
+				byID[r.ID] = len(merged)
+				merged = append(merged, r)
+				continue
+			}
+			if better(r.SimilarityScore, merged[i].SimilarityScore) {
+				merged[i] = r
+			}
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return better(merged[i].SimilarityScore, merged[j].SimilarityScore)
+	})
+	return merged
+}
+
+// PartialError is returned by ExecuteContainersSearch, alongside the merged
+// results of the healthy containers, when the search of some containers
+// failed. errors.Is and errors.As see every container's error.
+type PartialError struct {
+	Errors map[string]error // keyed by container ID
+}
+
+func (e *PartialError) Error() string {
+	ids := make([]string, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = fmt.Sprintf("container %q: %v", id, e.Errors[id])
+	}
+	return fmt.Sprintf("search failed for %d container(s): %s", len(ids), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error of each failed container.
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// ExecuteContainersSearch runs the same vector search against several
+// containers, for example separate hotel and vacation-rental catalogs that
+// share an embedded field, or one catalog split by region into hotels_us and
+// hotels_eu, and merges the results into one ranking by NormalizedScore.
+// Each result's Source names the container it came from. Searches run
+// concurrently, at most four at a time, and options apply to every search.
+//
+// When some searches fail, the results of the others are still returned
+// together with a *PartialError describing the failures; only when every
+// search fails is an error returned alone. Returns the merged results and
+// the total request charge.
+func ExecuteContainersSearch(
+	ctx context.Context,
+	containers []*azcosmos.ContainerClient,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	opts ...SearchOption,
+) ([]QueryResult, float64, error) {
+	if len(containers) == 0 {
+		return nil, 0, fmt.Errorf("multi-container search needs at least one container")
+	}
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	searchOpts := append(opts[:len(opts):len(opts)], WithSkip(0), WithTop(options.fetchCount()))
+
+	results := make([][]QueryResult, len(containers))
+	charges := make([]float64, len(containers))
+	errs := make([]error, len(containers))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentSearches)
+	for i, container := range containers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], charges[i], errs[i] = ExecuteVectorSearch(ctx, container, embedding, embeddedField, distanceFunction, searchOpts...)
+			for j := range results[i] {
+				results[i][j].Source = container.ID()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var totalCharge float64
+	var merged []QueryResult
+	failed := make(map[string]error)
+	for i, container := range containers {
+		totalCharge += charges[i]
+		if errs[i] != nil {
+			failed[container.ID()] = errs[i]
+			continue
+		}
+		merged = append(merged, results[i]...)
+	}
+	if len(failed) == len(containers) {
+		return nil, totalCharge, errors.Join((&PartialError{Errors: failed}).Unwrap()...)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].NormalizedScore > merged[j].NormalizedScore
+	})
+	// Documents in different catalogs are different properties even when
+	// their ids match, so they are merged only on request.
+	if options.MergeByID {
+		seen := make(map[string]bool, len(merged))
+		unique := merged[:0]
+		for _, r := range merged {
+			if !seen[r.ID] {
+				seen[r.ID] = true
+				unique = append(unique, r)
+			}
+		}
+		merged = unique
+	}
+	if len(merged) > options.fetchCount() {
+		merged = merged[:options.fetchCount()]
+	}
+
+	if len(failed) > 0 {
+		return page(options, merged), totalCharge, &PartialError{Errors: failed}
+	}
+	return page(options, merged), totalCharge, nil
+}
@@ -0,0 +1,25 @@
+package query
+
+// DefaultNegativeThreshold is the cosine similarity to a negative example at
+// or above which a result is dropped when WithNegativeThreshold is not used.
+const DefaultNegativeThreshold = 0.9
+
+// FilterNegativeExamples removes results whose vector has a cosine similarity
+// of at least threshold to any of the negative vectors, keeping the order of
+// the rest. Results must carry their Vector.
+func FilterNegativeExamples(results []QueryResult, negatives [][]float32, threshold float64) []QueryResult {
+	var kept []QueryResult
+	for _, r := range results {
+		excluded := false
+		for _, n := range negatives {
+			if CosineSimilarity(r.Vector, n) >= threshold {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
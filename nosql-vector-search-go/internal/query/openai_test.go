@@ -0,0 +1,82 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// fakeOpenAI is a policy.Transporter that answers Azure OpenAI requests in
+// process, so tests run the real SDK client without a service.
+type fakeOpenAI func(req *http.Request) (*http.Response, error)
+
+func (f fakeOpenAI) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
+// newFakeOpenAIClient returns an Azure OpenAI client whose requests go to
+// transport. SDK retries are off, so every call is one request.
+func newFakeOpenAIClient(t testing.TB, transport fakeOpenAI) *azopenai.Client {
+	t.Helper()
+	client, err := azopenai.NewClientWithKeyCredential("https://fake.openai.azure.com/", azcore.NewKeyCredential("test-key"),
+		&azopenai.ClientOptions{ClientOptions: azcore.ClientOptions{
+			Transport: transport,
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// jsonResponse returns a response to req with the given status and body
+// marshaled as JSON.
+func jsonResponse(req *http.Request, status int, body any) (*http.Response, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(raw)),
+		Request:    req,
+	}, nil
+}
+
+// embeddingsRequest is the part of an embeddings request body the fakes read.
+type embeddingsRequest struct {
+	Input      []string `json:"input"`
+	Dimensions *int     `json:"dimensions"`
+}
+
+// readEmbeddingsRequest decodes the body of an embeddings request.
+func readEmbeddingsRequest(req *http.Request) (embeddingsRequest, error) {
+	var body embeddingsRequest
+	err := json.NewDecoder(req.Body).Decode(&body)
+	return body, err
+}
+
+// echoEmbeddings answers an embeddings request whose inputs are decimal
+// numbers with a one-dimensional vector holding each number, listed in
+// reverse so callers must order the results by index.
+func echoEmbeddings(req *http.Request, body embeddingsRequest) (*http.Response, error) {
+	data := make([]map[string]any, len(body.Input))
+	for i, text := range body.Input {
+		n, err := strconv.ParseFloat(text, 32)
+		if err != nil {
+			return nil, err
+		}
+		data[len(data)-1-i] = map[string]any{"object": "embedding", "index": i, "embedding": []float32{float32(n)}}
+	}
+	return jsonResponse(req, http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   data,
+		"usage":  map[string]any{"prompt_tokens": len(body.Input), "total_tokens": len(body.Input)},
+	})
+}
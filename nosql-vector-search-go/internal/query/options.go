@@ -0,0 +1,420 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// DefaultTop is the number of results a search returns when WithTop is not used.
+const DefaultTop = 5
+
+// DefaultHybridAlpha weights the vector and full-text rankings of a hybrid
+// search equally.
+const DefaultHybridAlpha = 0.5
+
+// SearchOptions holds optional settings for ExecuteVectorSearch. By default a
+// search is unfiltered and returns the DefaultTop closest documents.
+type SearchOptions struct {
+	// Top is the number of documents the search returns (the page size).
+	Top int
+	// Skip is the number of top-ranked documents to pass over before the
+	// returned page starts.
+	Skip int
+	// Filter is a SQL predicate over the document alias "c" that is added as a
+	// WHERE clause, restricting the candidates before they are ranked.
+	Filter string
+	// FilterParameters supplies values for the parameters referenced in Filter.
+	FilterParameters []azcosmos.QueryParameter
+	// Geo, when set, restricts the candidates to hotels within a distance of
+	// a point. It is combined with Filter.
+	Geo *GeoFilter
+	// ExcludeDeleted leaves out hotels marked deleted by
+	// data.SoftDeleteHotel.
+	ExcludeDeleted bool
+	// Timeout bounds how long the search may take, including every page of
+	// results. Zero means no limit beyond the caller's context.
+	Timeout time.Duration
+	// MinScore, when set, drops results whose score is worse than the
+	// threshold. "Worse" depends on the distance function: below the
+	// threshold for cosine and dot product, above it for euclidean.
+	MinScore *float64
+	// SearchListSizeMultiplier widens the DiskANN candidate list searched at
+	// query time (1-100). Zero leaves the service default in place.
+	SearchListSizeMultiplier int
+	// BruteForce skips the vector index and scores every candidate exactly.
+	BruteForce bool
+	// IncludeVectors adds each document's embedding to QueryResult.Vector.
+	IncludeVectors bool
+	// HybridAlpha is the weight of the vector ranking in a hybrid search,
+	// from 0 (full-text only) to 1 (vector only). The full-text ranking gets
+	// the remaining 1-HybridAlpha.
+	HybridAlpha float64
+	// Dedupe removes near-duplicate hotels from the results, backfilling from
+	// lower-ranked documents so Top is still honored when enough remain.
+	Dedupe bool
+	// DedupeThreshold is the cosine similarity at or above which two results
+	// are duplicates. Zero uses DefaultDedupeThreshold.
+	DedupeThreshold float64
+	// NegativeExamples drops results that resemble any of these vectors.
+	NegativeExamples [][]float32
+	// NegativeThreshold is the cosine similarity to a negative example at or
+	// above which a result is dropped. Zero uses DefaultNegativeThreshold.
+	NegativeThreshold float64
+	// MergeByID keeps only the best-scoring result for each document id when
+	// ExecuteContainersSearch merges containers.
+	MergeByID bool
+	// CollapseChunks folds chunk documents into their parent hotel so each
+	// hotel appears once, backfilling from lower-ranked documents.
+	CollapseChunks bool
+
+	// hybridWeights holds the raw vector and text weights passed to
+	// WithHybridWeights until newSearchOptions validates them and turns them
+	// into HybridAlpha.
+	hybridWeights *[2]float64
+
+	// after resumes a paginated search behind the last result of the
+	// previous page. It is set by ExecuteVectorSearchPaginated.
+	after *cursorPosition
+}
+
+// SearchOption configures a SearchOptions value.
+type SearchOption func(*SearchOptions)
+
+// WithTop sets how many documents the search returns.
+func WithTop(n int) SearchOption {
+	return func(o *SearchOptions) {
+		o.Top = n
+	}
+}
+
+// WithSkip skips the first n ranked documents, so WithSkip(5) together with
+// WithTop(5) returns results 6-10. The query still ranks the top n+Top
+// documents and the first n are dropped in Go, so each page lines up exactly
+// with a single larger search.
+func WithSkip(n int) SearchOption {
+	return func(o *SearchOptions) {
+		o.Skip = n
+	}
+}
+
+// WithFilter restricts the search to documents matching the given predicate,
+// for example:
+//
+//	query.WithFilter("c.Address.City = @city AND c.Rating >= @minRating",
+//		azcosmos.QueryParameter{Name: "@city", Value: "Seattle"},
+//		azcosmos.QueryParameter{Name: "@minRating", Value: 4})
+//
+// The predicate is inserted into the query text as-is, so it must come from
+// code, not user input; pass user-supplied values as parameters instead.
+func WithFilter(predicate string, params ...azcosmos.QueryParameter) SearchOption {
+	return func(o *SearchOptions) {
+		o.Filter = predicate
+		o.FilterParameters = params
+	}
+}
+
+// GeoFilter restricts a search to documents whose Location point lies within
+// MaxMeters of the point at longitude Lon and latitude Lat.
+type GeoFilter struct {
+	Lon       float64
+	Lat       float64
+	MaxMeters float64
+}
+
+// WithGeoFilter restricts the search to hotels within maxMeters of the given
+// point, so a query such as "cozy hotel near downtown Seattle" can combine
+// semantic ranking with location. The distance is computed with ST_DISTANCE
+// over the GeoJSON Location field; a spatial index on /Location makes the
+// filter cheaper but is not required.
+func WithGeoFilter(lon, lat, maxMeters float64) SearchOption {
+	return func(o *SearchOptions) {
+		o.Geo = &GeoFilter{Lon: lon, Lat: lat, MaxMeters: maxMeters}
+	}
+}
+
+// WithExcludeDeleted leaves hotels that were soft-deleted (IsDeleted is true)
+// out of the results. Without it, searches return every document.
+func WithExcludeDeleted() SearchOption {
+	return func(o *SearchOptions) {
+		o.ExcludeDeleted = true
+	}
+}
+
+// WithTimeout limits how long a search may run. When the limit is reached
+// the search stops and returns an error matching ErrTimeout, so a slow query
+// can't hold up the caller indefinitely.
+func WithTimeout(d time.Duration) SearchOption {
+	return func(o *SearchOptions) {
+		o.Timeout = d
+	}
+}
+
+// WithMinScore drops results that do not meet the given score threshold.
+// The threshold is applied to the rows returned by the query, so a search can
+// return fewer than the requested number of results, or none at all.
+func WithMinScore(threshold float64) SearchOption {
+	return func(o *SearchOptions) {
+		o.MinScore = &threshold
+	}
+}
+
+// WithSearchListSizeMultiplier sets how many candidates a DiskANN index
+// examines per query, trading request units and latency for recall. It has no
+// effect on QuantizedFlat or flat indexes.
+func WithSearchListSizeMultiplier(multiplier int) SearchOption {
+	return func(o *SearchOptions) {
+		o.SearchListSizeMultiplier = multiplier
+	}
+}
+
+// WithBruteForce makes the search compare the query vector against every
+// candidate document instead of using the vector index. Results are exact but
+// cost more RUs, so use it to measure the recall of the index (see Recall)
+// rather than for regular queries.
+func WithBruteForce() SearchOption {
+	return func(o *SearchOptions) {
+		o.BruteForce = true
+	}
+}
+
+// WithVectors returns each document's embedding in QueryResult.Vector. The
+// embedding is left out by default because it is by far the largest part of
+// every row; request it only for client-side work such as MMR re-ranking.
+func WithVectors() SearchOption {
+	return func(o *SearchOptions) {
+		o.IncludeVectors = true
+	}
+}
+
+// WithHybridAlpha sets how ExecuteHybridSearch weights its two rankings:
+// 0 uses only full-text relevance, 1 uses only vector similarity, and values
+// in between blend the two. The default is DefaultHybridAlpha. Other searches
+// ignore it. Of WithHybridAlpha and WithHybridWeights, the last one given
+// applies.
+func WithHybridAlpha(alpha float64) SearchOption {
+	return func(o *SearchOptions) {
+		o.HybridAlpha = alpha
+		o.hybridWeights = nil
+	}
+}
+
+// WithDedupe removes near-duplicate hotels from the results: results whose
+// embeddings have a cosine similarity of at least threshold, or whose names
+// match, collapse to the best-ranked one. Pass 0 for DefaultDedupeThreshold.
+// The search reads three times as many documents, with their embeddings, so
+// it can backfill the results it drops.
+func WithDedupe(threshold float64) SearchOption {
+	return func(o *SearchOptions) {
+		o.Dedupe = true
+		o.DedupeThreshold = threshold
+	}
+}
+
+// withoutDedupe turns deduplication off for the candidate query a
+// deduplicated search runs.
+func withoutDedupe() SearchOption {
+	return func(o *SearchOptions) {
+		o.Dedupe = false
+	}
+}
+
+// WithNegativeExamples drops results that are too similar to any of the given
+// vectors, for example the embeddings of hotels the user has already seen and
+// rejected. The results are compared with each vector after retrieval, with
+// no extra request, so the search can return fewer than Top results.
+func WithNegativeExamples(vectors [][]float32) SearchOption {
+	return func(o *SearchOptions) {
+		o.NegativeExamples = vectors
+	}
+}
+
+// WithNegativeThreshold sets the cosine similarity, between 0 and 1, at or
+// above which WithNegativeExamples drops a result.
+func WithNegativeThreshold(threshold float64) SearchOption {
+	return func(o *SearchOptions) {
+		o.NegativeThreshold = threshold
+	}
+}
+
+// WithMergeByID makes ExecuteContainersSearch treat documents with the same id
+// in different containers as one hotel and keep its best-scoring copy. Use it
+// when one catalog is split across containers, for example by region.
+func WithMergeByID() SearchOption {
+	return func(o *SearchOptions) {
+		o.MergeByID = true
+	}
+}
+
+// WithCollapseChunks returns one result per hotel when long descriptions are
+// stored as chunk documents: chunk hits are replaced by their parent hotel,
+// keeping the matched passage in ChunkText. The search reads three times as
+// many documents so collapsed chunks are replaced from deeper results.
+func WithCollapseChunks() SearchOption {
+	return func(o *SearchOptions) {
+		o.CollapseChunks = true
+	}
+}
+
+// withoutCollapseChunks turns chunk collapsing off for the candidate query a
+// collapsing search runs.
+func withoutCollapseChunks() SearchOption {
+	return func(o *SearchOptions) {
+		o.CollapseChunks = false
+	}
+}
+
+// WithHybridWeights sets how ExecuteHybridSearch weights its two rankings as
+// a pair of non-negative weights, for example WithHybridWeights(1, 3) to favor
+// exact text matches for branded queries. The weights are normalized to sum to
+// 1, so this is the same as WithHybridAlpha(vectorWeight / (vectorWeight +
+// textWeight)), and like it overrides any earlier WithHybridAlpha.
+func WithHybridWeights(vectorWeight, textWeight float64) SearchOption {
+	return func(o *SearchOptions) {
+		o.hybridWeights = &[2]float64{vectorWeight, textWeight}
+	}
+}
+
+func newSearchOptions(opts []SearchOption) (*SearchOptions, error) {
+	o := &SearchOptions{Top: DefaultTop, HybridAlpha: DefaultHybridAlpha}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Top < 1 {
+		return nil, fmt.Errorf("top must be at least 1, got %d", o.Top)
+	}
+	if o.Skip < 0 {
+		return nil, fmt.Errorf("skip must not be negative, got %d", o.Skip)
+	}
+	if o.SearchListSizeMultiplier < 0 || o.SearchListSizeMultiplier > 100 {
+		return nil, fmt.Errorf("search list size multiplier must be between 1 and 100, got %d", o.SearchListSizeMultiplier)
+	}
+	if w := o.hybridWeights; w != nil {
+		if w[0] < 0 || w[1] < 0 || w[0]+w[1] == 0 {
+			return nil, fmt.Errorf("hybrid weights must be non-negative and not both zero, got vector %g, text %g", w[0], w[1])
+		}
+		o.HybridAlpha = w[0] / (w[0] + w[1])
+	}
+	if o.HybridAlpha < 0 || o.HybridAlpha > 1 {
+		return nil, fmt.Errorf("hybrid alpha must be between 0 and 1, got %g", o.HybridAlpha)
+	}
+	if o.Timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative, got %s", o.Timeout)
+	}
+	if o.DedupeThreshold < 0 || o.DedupeThreshold > 1 {
+		return nil, fmt.Errorf("dedupe threshold must be between 0 and 1, got %g", o.DedupeThreshold)
+	}
+	if o.Dedupe && o.DedupeThreshold == 0 {
+		o.DedupeThreshold = DefaultDedupeThreshold
+	}
+	if o.NegativeThreshold < 0 || o.NegativeThreshold > 1 {
+		return nil, fmt.Errorf("negative example threshold must be between 0 and 1, got %g", o.NegativeThreshold)
+	}
+	if o.NegativeThreshold == 0 {
+		o.NegativeThreshold = DefaultNegativeThreshold
+	}
+	if o.Geo != nil {
+		if o.Geo.Lon < -180 || o.Geo.Lon > 180 || o.Geo.Lat < -90 || o.Geo.Lat > 90 {
+			return nil, fmt.Errorf("geo filter point (%g, %g) is not a valid longitude and latitude", o.Geo.Lon, o.Geo.Lat)
+		}
+		if o.Geo.MaxMeters <= 0 {
+			return nil, fmt.Errorf("geo filter distance must be positive, got %g", o.Geo.MaxMeters)
+		}
+	}
+	for _, p := range o.FilterParameters {
+		switch p.Name {
+		case "@embedding":
+			return nil, fmt.Errorf("filter parameter name %q is reserved for the query vector", p.Name)
+		case "@cursorScore", "@cursorIds":
+			return nil, fmt.Errorf("filter parameter name %q is reserved for pagination", p.Name)
+		case "@geoPoint", "@geoMaxMeters":
+			return nil, fmt.Errorf("filter parameter name %q is reserved for the geo filter", p.Name)
+		}
+	}
+	return o, nil
+}
+
+// withTimeout returns ctx bounded by the configured timeout, if any.
+func (o *SearchOptions) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, o.Timeout)
+}
+
+// fetchCount is the number of ranked documents a query must return to cover
+// the skipped documents plus the requested page.
+func (o *SearchOptions) fetchCount() int {
+	return o.Skip + o.Top
+}
+
+// page drops the skipped documents from a ranked result list.
+func page[T any](o *SearchOptions, results []T) []T {
+	if o.Skip >= len(results) {
+		return nil
+	}
+	return results[o.Skip:]
+}
+
+// vectorDistanceOptions returns the options object passed as the fourth
+// argument of VectorDistance.
+func (o *SearchOptions) vectorDistanceOptions(distanceFunction string) string {
+	if o.SearchListSizeMultiplier > 0 {
+		return fmt.Sprintf("{'distanceFunction': '%s', 'searchListSizeMultiplier': %d}", distanceFunction, o.SearchListSizeMultiplier)
+	}
+	return fmt.Sprintf("{'distanceFunction': '%s'}", distanceFunction)
+}
+
+// whereClause returns the WHERE clause for the configured filters and any
+// extra predicates, or an empty string when there are none.
+func (o *SearchOptions) whereClause(extra ...string) string {
+	var predicates []string
+	if o.Filter != "" {
+		predicates = append(predicates, "("+o.Filter+")")
+	}
+	if o.ExcludeDeleted {
+		predicates = append(predicates, "NOT (IS_DEFINED(c.IsDeleted) AND c.IsDeleted = true)")
+	}
+	if o.Geo != nil {
+		predicates = append(predicates, "ST_DISTANCE(c.Location, @geoPoint) <= @geoMaxMeters")
+	}
+	for _, p := range extra {
+		if p != "" {
+			predicates = append(predicates, p)
+		}
+	}
+	if len(predicates) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(predicates, " AND ") + " "
+}
+
+// filterParameters returns the parameters referenced by whereClause.
+func (o *SearchOptions) filterParameters() []azcosmos.QueryParameter {
+	params := o.FilterParameters
+	if o.Geo != nil {
+		params = append(params[:len(params):len(params)],
+			azcosmos.QueryParameter{Name: "@geoPoint", Value: map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []float64{o.Geo.Lon, o.Geo.Lat},
+			}},
+			azcosmos.QueryParameter{Name: "@geoMaxMeters", Value: o.Geo.MaxMeters},
+		)
+	}
+	return params
+}
+
+// meetsMinScore reports whether a score satisfies the MinScore threshold for
+// the given distance function. It always returns true when no threshold is set.
+func (o *SearchOptions) meetsMinScore(score float64, distanceFunction string) bool {
+	if o.MinScore == nil {
+		return true
+	}
+	if HigherIsBetter(distanceFunction) {
+		return score >= *o.MinScore
+	}
+	return score <= *o.MinScore
+}
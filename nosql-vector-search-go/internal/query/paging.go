@@ -0,0 +1,184 @@
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// PagedSearchResult is one page of a paginated vector search.
+type PagedSearchResult struct {
+	Results []QueryResult
+	// NextCursor resumes the search after this page. It is empty when
+	// HasMore is false.
+	NextCursor string
+	HasMore    bool
+}
+
+// cursorPosition is the decoded form of a pagination cursor: the score of the
+// last result returned and the ids of every returned result with that score,
+// so documents tied at the page boundary are neither repeated nor skipped.
+type cursorPosition struct {
+	Score float64  `json:"s"`
+	IDs   []string `json:"ids"`
+}
+
+// ExecuteVectorSearchPaginated returns one page of pageSize results of a
+// vector search. Pass an empty cursor for the first page and the previous
+// page's NextCursor for the following ones; the cursor must come from a
+// search with the same embedding, field, distance function, and options.
+//
+// Rather than re-ranking and skipping every earlier result, each page asks
+// only for documents scoring behind the previous page's last result, so the
+// cost of a page does not grow with its depth. WithTop and WithSkip are
+// ignored. WithNegativeExamples, WithDedupe, and WithCollapseChunks are
+// rejected: they drop or merge results after the query, so a short page
+// would not mean the last one, and a hotel could come back on a later page
+// through another of its chunks.
+func ExecuteVectorSearchPaginated(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	pageSize int,
+	cursor string,
+	opts ...SearchOption,
+) (*PagedSearchResult, float64, error) {
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkPageable(options); err != nil {
+		return nil, 0, err
+	}
+	return paginate(pageSize, cursor, func(after *cursorPosition, top int) ([]QueryResult, float64, error) {
+		pageOpts := append(opts[:len(opts):len(opts)], WithSkip(0), WithTop(top), withCursor(after))
+		return ExecuteVectorSearch(ctx, container, embedding, embeddedField, distanceFunction, pageOpts...)
+	})
+}
+
+// paginate returns the page of pageSize results after cursor. search returns
+// the top ranked results behind a position, nil meaning from the start.
+func paginate(pageSize int, cursor string, search func(after *cursorPosition, top int) ([]QueryResult, float64, error)) (*PagedSearchResult, float64, error) {
+	if pageSize < 1 {
+		return nil, 0, fmt.Errorf("page size must be at least 1, got %d", pageSize)
+	}
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// One extra result tells whether another page exists.
+	results, charge, err := search(after, pageSize+1)
+	if err != nil {
+		return nil, charge, err
+	}
+
+	paged := &PagedSearchResult{Results: results}
+	if len(results) > pageSize {
+		paged.Results = results[:pageSize]
+		paged.HasMore = true
+		paged.NextCursor, err = encodeCursor(nextPosition(after, paged.Results))
+		if err != nil {
+			return nil, charge, err
+		}
+	}
+	return paged, charge, nil
+}
+
+// checkPageable returns an error naming the options that filter or merge
+// results after the query, which cursor pagination cannot page through.
+func checkPageable(o *SearchOptions) error {
+	var unsupported []string
+	if len(o.NegativeExamples) > 0 {
+		unsupported = append(unsupported, "WithNegativeExamples")
+	}
+	if o.Dedupe {
+		unsupported = append(unsupported, "WithDedupe")
+	}
+	if o.CollapseChunks {
+		unsupported = append(unsupported, "WithCollapseChunks")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("paginated search does not support %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// withCursor resumes a search after the given position; nil starts from the
+// top.
+func withCursor(after *cursorPosition) SearchOption {
+	return func(o *SearchOptions) {
+		o.after = after
+	}
+}
+
+// nextPosition returns the cursor position after the last of results,
+// carrying over the previous position's ids when the tie at the boundary
+// spans more than one page.
+func nextPosition(prev *cursorPosition, results []QueryResult) *cursorPosition {
+	last := results[len(results)-1].SimilarityScore
+	next := &cursorPosition{Score: last}
+	if prev != nil && prev.Score == last {
+		next.IDs = append(next.IDs, prev.IDs...)
+	}
+	for _, r := range results {
+		if r.SimilarityScore == last {
+			next.IDs = append(next.IDs, r.ID)
+		}
+	}
+	return next
+}
+
+// predicate returns the query condition that selects documents ranked after
+// the cursor position, or an empty string for a nil position.
+func (c *cursorPosition) predicate(vectorDistance, distanceFunction string) string {
+	if c == nil {
+		return ""
+	}
+	behind := "<"
+	if !HigherIsBetter(distanceFunction) {
+		behind = ">"
+	}
+	return fmt.Sprintf("(%s %s @cursorScore OR (%s = @cursorScore AND NOT ARRAY_CONTAINS(@cursorIds, c.id)))",
+		vectorDistance, behind, vectorDistance)
+}
+
+// parameters returns the query parameters referenced by predicate.
+func (c *cursorPosition) parameters() []azcosmos.QueryParameter {
+	if c == nil {
+		return nil
+	}
+	return []azcosmos.QueryParameter{
+		{Name: "@cursorScore", Value: c.Score},
+		{Name: "@cursorIds", Value: c.IDs},
+	}
+}
+
+func encodeCursor(c *cursorPosition) (string, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(cursor string) (*cursorPosition, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var c cursorPosition
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return &c, nil
+}
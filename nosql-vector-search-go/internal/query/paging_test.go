@@ -0,0 +1,180 @@
+package query
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeCollection ranks its documents the way the paginated query does:
+// by SimilarityScore, best first, keeping only those behind the cursor
+// position that predicate describes.
+type fakeCollection struct {
+	docs             []QueryResult
+	distanceFunction string
+}
+
+func (f *fakeCollection) search(after *cursorPosition, top int) ([]QueryResult, float64, error) {
+	ranked := slices.Clone(f.docs)
+	slices.SortStableFunc(ranked, func(a, b QueryResult) int {
+		if HigherIsBetter(f.distanceFunction) {
+			return cmp.Compare(b.SimilarityScore, a.SimilarityScore)
+		}
+		return cmp.Compare(a.SimilarityScore, b.SimilarityScore)
+	})
+
+	var results []QueryResult
+	for _, d := range ranked {
+		if after != nil {
+			behind := d.SimilarityScore < after.Score
+			if !HigherIsBetter(f.distanceFunction) {
+				behind = d.SimilarityScore > after.Score
+			}
+			tied := d.SimilarityScore == after.Score && !slices.Contains(after.IDs, d.ID)
+			if !behind && !tied {
+				continue
+			}
+		}
+		if len(results) == top {
+			break
+		}
+		results = append(results, d)
+	}
+	return results, 1, nil
+}
+
+// readAllPages pages through the collection and returns the ids in the order
+// they were returned.
+func readAllPages(t *testing.T, f *fakeCollection, pageSize int) []string {
+	t.Helper()
+	var ids []string
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > len(f.docs) {
+			t.Fatal("pagination did not terminate")
+		}
+		paged, _, err := paginate(pageSize, cursor, f.search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paged.Results) > pageSize {
+			t.Fatalf("page %d has %d results, want at most %d", page, len(paged.Results), pageSize)
+		}
+		for _, r := range paged.Results {
+			ids = append(ids, r.ID)
+		}
+		if !paged.HasMore {
+			if paged.NextCursor != "" {
+				t.Errorf("last page has cursor %q", paged.NextCursor)
+			}
+			return ids
+		}
+		cursor = paged.NextCursor
+	}
+}
+
+func TestPaginationContinuity(t *testing.T) {
+	tests := []struct {
+		name             string
+		distanceFunction string
+		scores           []float64
+	}{
+		{"distinct scores", DistanceCosine, []float64{0.9, 0.8, 0.7, 0.6, 0.5, 0.4, 0.3}},
+		{"ties across a page boundary", DistanceCosine, []float64{0.9, 0.8, 0.8, 0.8, 0.8, 0.8, 0.7}},
+		{"every score tied", DistanceCosine, []float64{0.5, 0.5, 0.5, 0.5, 0.5}},
+		{"euclidean ranks low distances first", DistanceEuclidean, []float64{0.1, 0.2, 0.2, 0.2, 0.5, 0.9}},
+	}
+
+	for _, tt := range tests {
+		for pageSize := 1; pageSize <= len(tt.scores)+1; pageSize++ {
+			t.Run(fmt.Sprintf("%s/page size %d", tt.name, pageSize), func(t *testing.T) {
+				f := &fakeCollection{distanceFunction: tt.distanceFunction}
+				for i, score := range tt.scores {
+					f.docs = append(f.docs, QueryResult{ID: fmt.Sprint(i), SimilarityScore: score})
+				}
+				want, _, _ := f.search(nil, len(f.docs))
+
+				got := readAllPages(t, f, pageSize)
+				if strings.Join(got, ",") != resultIDs(want) {
+					t.Errorf("pages returned %v, want %s", got, resultIDs(want))
+				}
+			})
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	in := &cursorPosition{Score: 0.8125, IDs: []string{"7", "hotel-12"}}
+	cursor, err := encodeCursor(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(cursor, "+/=") {
+		t.Errorf("cursor %q is not URL-safe", cursor)
+	}
+
+	out, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Score != in.Score || !slices.Equal(out.IDs, in.IDs) {
+		t.Errorf("decoded %+v, want %+v", out, in)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	if c, err := decodeCursor(""); c != nil || err != nil {
+		t.Errorf(`decodeCursor("") = %v, %v; want nil, nil`, c, err)
+	}
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) accepted an invalid cursor", cursor)
+		}
+	}
+}
+
+func TestPaginateRejectsBadPageSize(t *testing.T) {
+	f := &fakeCollection{}
+	if _, _, err := paginate(0, "", f.search); err == nil {
+		t.Error("paginate accepted a page size of 0")
+	}
+}
+
+func TestCursorPredicateDirection(t *testing.T) {
+	c := &cursorPosition{Score: 0.5, IDs: []string{"1"}}
+	if got := c.predicate("d", DistanceCosine); !strings.HasPrefix(got, "(d < @cursorScore") {
+		t.Errorf("cosine predicate = %s, want documents scoring lower", got)
+	}
+	if got := c.predicate("d", DistanceEuclidean); !strings.HasPrefix(got, "(d > @cursorScore") {
+		t.Errorf("euclidean predicate = %s, want documents further away", got)
+	}
+	if got := (*cursorPosition)(nil).predicate("d", DistanceCosine); got != "" {
+		t.Errorf("nil cursor predicate = %q, want none", got)
+	}
+}
+
+func TestPaginatedSearchRejectsPostFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  SearchOption
+	}{
+		// Each can return a short page while more matches exist.
+		{"negative examples", WithNegativeExamples([][]float32{{1, 0}})},
+		{"dedupe", WithDedupe(0)},
+		// Collapsed results carry the parent id, which the cursor can't
+		// exclude from later pages.
+		{"collapse chunks", WithCollapseChunks()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The options are checked before the container is used.
+			_, _, err := ExecuteVectorSearchPaginated(context.Background(), nil, []float32{1, 0}, "DescriptionVector", DistanceCosine, 10, "", tt.opt)
+			if err == nil || !strings.Contains(err.Error(), "does not support") {
+				t.Errorf("ExecuteVectorSearchPaginated = %v, want the option rejected", err)
+			}
+		})
+	}
+}
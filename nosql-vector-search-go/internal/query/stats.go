@@ -0,0 +1,225 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// VectorIndex is a vector index defined in a container's indexing policy.
+type VectorIndex struct {
+	Path string
+	Type string
+}
+
+// ContainerStats summarizes what a container holds.
+type ContainerStats struct {
+	// DocumentCount is the exact number of hotel documents in the sample's
+	// partition, not counting description chunks.
+	DocumentCount int
+	// ChunkCount is the number of description chunk documents (those with a
+	// ParentId) stored alongside the hotels.
+	ChunkCount int
+	// DocumentsSizeKB and IndexSizeKB come from the container's quota usage,
+	// which Cosmos DB updates periodically, so they can lag recent writes.
+	DocumentsSizeKB int64
+	IndexSizeKB     int64
+	// VectorIndexes lists the container's vector indexes. Cosmos DB reports
+	// index storage for the container as a whole, not per index.
+	VectorIndexes []VectorIndex
+	// IndexTransformationProgress is the percentage (0-100) of the latest
+	// indexing policy change that has been applied. It is 100 when no change
+	// is in progress.
+	IndexTransformationProgress int
+}
+
+// IndexReady reports whether every index, including newly added vector
+// indexes, has finished building. Queries still run while an index builds,
+// but they can be slower and more expensive.
+func (s *ContainerStats) IndexReady() bool {
+	return s.IndexTransformationProgress >= 100
+}
+
+// AverageDocumentSizeKB returns the mean size of the hotel and chunk
+// documents, or 0 for an empty container.
+func (s *ContainerStats) AverageDocumentSizeKB() float64 {
+	if n := s.DocumentCount + s.ChunkCount; n > 0 {
+		return float64(s.DocumentsSizeKB) / float64(n)
+	}
+	return 0
+}
+
+// HasVectorIndex reports whether the container indexes the given field.
+func (s *ContainerStats) HasVectorIndex(embeddedField string) bool {
+	for _, idx := range s.VectorIndexes {
+		if idx.Path == "/"+embeddedField {
+			return true
+		}
+	}
+	return false
+}
+
+// GetContainerStats counts the hotels and description chunks in the
+// container and reads its storage usage, vector indexes, and index build
+// progress. It costs one container read and two COUNT queries.
+func GetContainerStats(ctx context.Context, container *azcosmos.ContainerClient) (*ContainerStats, error) {
+	resp, err := container.Read(ctx, &azcosmos.ReadContainerOptions{PopulateQuotaInfo: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container %q: %w", container.ID(), ClassifyError(err))
+	}
+
+	body, err := runtime.Payload(resp.RawResponse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container %q definition: %w", container.ID(), err)
+	}
+	var settings containerVectorSettings
+	if err := json.Unmarshal(body, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse container %q definition: %w", container.ID(), err)
+	}
+
+	stats := &ContainerStats{}
+	for _, idx := range settings.IndexingPolicy.VectorIndexes {
+		stats.VectorIndexes = append(stats.VectorIndexes, VectorIndex{Path: idx.Path, Type: idx.Type})
+	}
+
+	// x-ms-resource-usage looks like "documentsSize=120;documentsCount=50;collectionSize=180;..."
+	// with sizes in KB; the difference between collection and document size
+	// is index storage.
+	usage := parseResourceUsage(resp.RawResponse.Header.Get("x-ms-resource-usage"))
+	stats.DocumentsSizeKB = usage["documentsSize"]
+	stats.IndexSizeKB = max(usage["collectionSize"]-usage["documentsSize"], 0)
+
+	stats.IndexTransformationProgress = indexTransformationProgress(resp)
+
+	if stats.DocumentCount, err = countDocuments(ctx, container, "NOT IS_DEFINED(c.ParentId)"); err != nil {
+		return nil, err
+	}
+	if stats.ChunkCount, err = countDocuments(ctx, container, "IS_DEFINED(c.ParentId)"); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// countDocuments counts the documents in the sample's partition that match
+// the where clause.
+func countDocuments(ctx context.Context, container *azcosmos.ContainerClient, where string) (int, error) {
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	pager := container.NewQueryItemsPager("SELECT VALUE COUNT(1) FROM c WHERE "+where, pk, nil)
+	count := 0
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count documents: %w", ClassifyError(err))
+		}
+		for _, raw := range page.Items {
+			var n int
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return 0, fmt.Errorf("failed to parse document count: %w", err)
+			}
+			count += n
+		}
+	}
+	return count, nil
+}
+
+// WaitForIndexReady polls the container every pollInterval until its
+// indexing policy has been fully applied, so the vector index on
+// embeddedField is built before it is queried. It returns ErrNoVectorPolicy
+// if the container has no vector index on the field, and an
+// ErrIndexNotReady error with the last reported progress if ctx is done
+// first.
+func WaitForIndexReady(ctx context.Context, container *azcosmos.ContainerClient, embeddedField string, pollInterval time.Duration) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := container.Read(ctx, &azcosmos.ReadContainerOptions{PopulateQuotaInfo: true})
+		if err != nil {
+			return fmt.Errorf("failed to read container %q: %w", container.ID(), ClassifyError(err))
+		}
+		body, err := runtime.Payload(resp.RawResponse)
+		if err != nil {
+			return fmt.Errorf("failed to read container %q definition: %w", container.ID(), err)
+		}
+		var settings containerVectorSettings
+		if err := json.Unmarshal(body, &settings); err != nil {
+			return fmt.Errorf("failed to parse container %q definition: %w", container.ID(), err)
+		}
+		indexed := false
+		for _, idx := range settings.IndexingPolicy.VectorIndexes {
+			indexed = indexed || idx.Path == "/"+embeddedField
+		}
+		if !indexed {
+			return fmt.Errorf("%w: /%s in container %q", ErrNoVectorPolicy, embeddedField, container.ID())
+		}
+
+		progress := indexTransformationProgress(resp)
+		if progress >= 100 {
+			return nil
+		}
+		slog.DebugContext(ctx, "waiting for index build", slog.String("container", container.ID()), slog.Int("progress", progress))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: container %q index build is %d%% complete: %w",
+				ErrIndexNotReady, container.ID(), progress, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// indexTransformationProgress returns the percentage of the latest indexing
+// policy change that has been applied, or 100 when none is in progress.
+func indexTransformationProgress(resp azcosmos.ContainerResponse) int {
+	if v := resp.RawResponse.Header.Get("x-ms-documentdb-collection-index-transformation-progress"); v != "" {
+		if progress, err := strconv.Atoi(v); err == nil {
+			return progress
+		}
+	}
+	return 100
+}
+
+// parseResourceUsage splits a semicolon-separated list of name=value pairs,
+// skipping values that are not integers.
+func parseResourceUsage(header string) map[string]int64 {
+	usage := make(map[string]int64)
+	for _, pair := range strings.Split(header, ";") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			usage[name] = n
+		}
+	}
+	return usage
+}
+
+// PrintContainerStats outputs a short summary of the container's contents.
+func PrintContainerStats(stats *ContainerStats, embeddedField string) {
+	fmt.Println("\n--- Container Stats ---")
+	if stats.ChunkCount > 0 {
+		fmt.Printf("Documents: %d hotels, %d description chunks (average %.1f KB)\n", stats.DocumentCount, stats.ChunkCount, stats.AverageDocumentSizeKB())
+	} else {
+		fmt.Printf("Documents: %d (average %.1f KB)\n", stats.DocumentCount, stats.AverageDocumentSizeKB())
+	}
+	fmt.Printf("Storage: %d KB documents, %d KB indexes\n", stats.DocumentsSizeKB, stats.IndexSizeKB)
+	for _, idx := range stats.VectorIndexes {
+		fmt.Printf("Vector index: %s (%s)\n", idx.Path, idx.Type)
+	}
+	if !stats.HasVectorIndex(embeddedField) {
+		fmt.Printf("Vector index: none on /%s\n", embeddedField)
+	}
+	if !stats.IndexReady() {
+		fmt.Printf("Index build: %d%% complete\n", stats.IndexTransformationProgress)
+	}
+	fmt.Println("-----------------------")
+}
@@ -0,0 +1,90 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// newIntegrationDatabase connects to the Cosmos DB account in
+// AZURE_COSMOSDB_ENDPOINT with the default Azure credential and returns the
+// database in AZURE_COSMOSDB_DATABASENAME ("Hotels" if unset). The test is
+// skipped when no endpoint is configured.
+func newIntegrationDatabase(t *testing.T) *azcosmos.DatabaseClient {
+	t.Helper()
+	endpoint := os.Getenv("AZURE_COSMOSDB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AZURE_COSMOSDB_ENDPOINT is not set; skipping integration test")
+	}
+	dbName := os.Getenv("AZURE_COSMOSDB_DATABASENAME")
+	if dbName == "" {
+		dbName = "Hotels"
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := azcosmos.NewClient(endpoint, cred, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := client.NewDatabase(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// newIntegrationContainer creates an empty container with the sample's
+// partition key path and deletes it when the test ends.
+func newIntegrationContainer(t *testing.T, ctx context.Context) *azcosmos.ContainerClient {
+	t.Helper()
+	database := newIntegrationDatabase(t)
+	id := fmt.Sprintf("smoke-%d", time.Now().UnixNano())
+	if _, err := database.CreateContainer(ctx, azcosmos.ContainerProperties{
+		ID:                     id,
+		PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{Paths: []string{"/HotelId"}},
+	}, nil); err != nil {
+		t.Fatalf("failed to create container %q: %v", id, ClassifyError(err))
+	}
+	container, err := database.NewContainer(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := container.Delete(context.Background(), nil); err != nil {
+			t.Errorf("failed to delete container %q: %v", id, err)
+		}
+	})
+	return container
+}
+
+func TestIntegrationInsertAndCount(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	container := newIntegrationContainer(t, ctx)
+
+	body, err := json.Marshal(map[string]any{"id": "1", "HotelId": partitionKeyValue, "HotelName": "Smoke Test Inn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+	if _, err := container.CreateItem(ctx, pk, body, nil); err != nil {
+		t.Fatalf("failed to insert document: %v", ClassifyError(err))
+	}
+
+	stats, err := GetContainerStats(ctx, container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DocumentCount != 1 {
+		t.Errorf("DocumentCount = %d, want 1", stats.DocumentCount)
+	}
+}
@@ -0,0 +1,102 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+)
+
+// UsageReport counts the Azure OpenAI tokens recorded in a Usage.
+type UsageReport struct {
+	EmbeddingTokens  int64 // query and document embeddings
+	ChatPromptTokens int64 // prompts sent to the chat model (ExplainResults)
+	// ChatCompletionTokens are the tokens the chat model generated.
+	ChatCompletionTokens int64
+}
+
+// Total returns the tokens used across all calls.
+func (u UsageReport) Total() int64 {
+	return u.EmbeddingTokens + u.ChatPromptTokens + u.ChatCompletionTokens
+}
+
+// Usage accumulates the token counts of the embeddings and chat responses
+// of calls made with a context from WithUsage. It is safe for concurrent
+// use, such as by GenerateEmbeddingsConcurrent's workers. The zero value is
+// ready to use.
+type Usage struct {
+	embedding, chatPrompt, chatCompletion atomic.Int64
+}
+
+// usageKey is the context key of the Usage set by WithUsage.
+type usageKey struct{}
+
+// WithUsage returns a copy of ctx under which the embeddings and chat calls
+// in this package add their tokens to u. Calls made without one record
+// nothing. Give each run or conversation its own Usage to count it
+// separately.
+func WithUsage(ctx context.Context, u *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+// usageFrom returns the Usage set on ctx, or nil.
+func usageFrom(ctx context.Context) *Usage {
+	u, _ := ctx.Value(usageKey{}).(*Usage)
+	return u
+}
+
+// Report returns the tokens used so far. It is safe to call concurrently
+// with searches and loads.
+func (u *Usage) Report() UsageReport {
+	return UsageReport{
+		EmbeddingTokens:      u.embedding.Load(),
+		ChatPromptTokens:     u.chatPrompt.Load(),
+		ChatCompletionTokens: u.chatCompletion.Load(),
+	}
+}
+
+// Reset sets the counts to zero, for example at the start of each
+// conversation in a long-running process, and returns the counts it
+// cleared.
+func (u *Usage) Reset() UsageReport {
+	return UsageReport{
+		EmbeddingTokens:      u.embedding.Swap(0),
+		ChatPromptTokens:     u.chatPrompt.Swap(0),
+		ChatCompletionTokens: u.chatCompletion.Swap(0),
+	}
+}
+
+func recordEmbeddingUsage(ctx context.Context, u *azopenai.EmbeddingsUsage) {
+	usage := usageFrom(ctx)
+	if usage != nil && u != nil && u.PromptTokens != nil {
+		usage.embedding.Add(int64(*u.PromptTokens))
+	}
+}
+
+func recordChatUsage(ctx context.Context, u *azopenai.CompletionsUsage) {
+	usage := usageFrom(ctx)
+	if usage == nil || u == nil {
+		return
+	}
+	if u.PromptTokens != nil {
+		usage.chatPrompt.Add(int64(*u.PromptTokens))
+	}
+	if u.CompletionTokens != nil {
+		usage.chatCompletion.Add(int64(*u.CompletionTokens))
+	}
+}
+
+// PrintUsage outputs a token usage summary. Nothing is printed when no
+// tokens were used.
+func PrintUsage(u UsageReport) {
+	if u.Total() == 0 {
+		return
+	}
+	fmt.Println("--- Azure OpenAI token usage ---")
+	fmt.Printf("Embeddings: %d\n", u.EmbeddingTokens)
+	if u.ChatPromptTokens+u.ChatCompletionTokens > 0 {
+		fmt.Printf("Chat:       %d prompt + %d completion\n", u.ChatPromptTokens, u.ChatCompletionTokens)
+	}
+	fmt.Printf("Total:      %d\n", u.Total())
+}
@@ -0,0 +1,37 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestUsageCountsCallsWithItsContext(t *testing.T) {
+	client := newFakeOpenAIClient(t, func(req *http.Request) (*http.Response, error) {
+		body, err := readEmbeddingsRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		return echoEmbeddings(req, body)
+	})
+
+	usage := &Usage{}
+	ctx := WithUsage(context.Background(), usage)
+	if _, err := GenerateEmbeddingsConcurrent(ctx, client, numberInputs(10), "embed", 3, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateEmbedding(ctx, client, "1", "embed"); err != nil {
+		t.Fatal(err)
+	}
+	// A call without the Usage in its context is not counted.
+	if _, err := GenerateEmbedding(context.Background(), client, "1", "embed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := usage.Report(); got != (UsageReport{EmbeddingTokens: 11}) {
+		t.Errorf("Report = %+v, want 11 embedding tokens", got)
+	}
+	if cleared := usage.Reset(); cleared.EmbeddingTokens != 11 || usage.Report().Total() != 0 {
+		t.Errorf("Reset = %+v, leaving %+v; want 11 tokens cleared", cleared, usage.Report())
+	}
+}
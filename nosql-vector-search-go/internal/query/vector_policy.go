@@ -0,0 +1,214 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// ErrNoVectorPolicy is returned by VerifyVectorPolicy when the container has
+// no vector embedding policy or vector index for the embedded field.
+var ErrNoVectorPolicy = errors.New("container has no vector policy for the embedded field")
+
+// ErrIndexNotReady is returned by WaitForIndexReady when the context is done
+// before the container's indexes have finished building.
+var ErrIndexNotReady = errors.New("index is not ready")
+
+// ErrDimensionMismatch is matched by errors.Is for every
+// *DimensionMismatchError.
+var ErrDimensionMismatch = errors.New("vector dimension mismatch")
+
+// DimensionMismatchError reports a vector whose length differs from the
+// dimensions the container's vector policy declares for the field.
+type DimensionMismatchError struct {
+	Field    string
+	Expected int // dimensions in the container's vector policy
+	Actual   int // length of the vector being written or searched
+}
+
+func (e *DimensionMismatchError) Error() string {
+	return fmt.Sprintf("vector for %s has %d dimensions but the container's vector policy expects %d; "+
+		"check that the embedding deployment matches the model the container was built for",
+		e.Field, e.Actual, e.Expected)
+}
+
+// Is reports whether target is ErrDimensionMismatch.
+func (e *DimensionMismatchError) Is(target error) bool {
+	return target == ErrDimensionMismatch
+}
+
+// VectorPolicySpec describes the vector embedding and index settings the
+// sample expects on its container.
+type VectorPolicySpec struct {
+	EmbeddedField    string
+	Dimensions       int
+	DistanceFunction string
+	IndexType        string // "diskANN", "quantizedFlat" or "flat"
+}
+
+// VectorPolicyDriftError reports how the container's vector settings differ
+// from the requested spec. The vector embedding policy of an existing
+// container cannot be changed, so the fix is to recreate the container
+// (for example with azd up) and reload the data.
+type VectorPolicyDriftError struct {
+	Container   string
+	Differences []string
+}
+
+func (e *VectorPolicyDriftError) Error() string {
+	return fmt.Sprintf("vector policy of container %q does not match the configuration: %s",
+		e.Container, strings.Join(e.Differences, "; "))
+}
+
+// containerVectorSettings is the subset of the container resource body that
+// describes vector embeddings and vector indexes.
+type containerVectorSettings struct {
+	VectorEmbeddingPolicy struct {
+		VectorEmbeddings []struct {
+			Path             string `json:"path"`
+			DataType         string `json:"dataType"`
+			DistanceFunction string `json:"distanceFunction"`
+			Dimensions       int    `json:"dimensions"`
+		} `json:"vectorEmbeddings"`
+	} `json:"vectorEmbeddingPolicy"`
+	IndexingPolicy struct {
+		VectorIndexes []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"vectorIndexes"`
+	} `json:"indexingPolicy"`
+}
+
+// VerifyVectorPolicy reads the container definition and compares its vector
+// embedding policy and vector index for spec.EmbeddedField against spec. It
+// returns nil when they match, ErrNoVectorPolicy when the field has no vector
+// policy, and a *VectorPolicyDriftError listing every difference otherwise.
+//
+// Running this before inserting or searching catches, for example, an
+// embedding deployment that now produces 3072 dimensions against a container
+// indexed for 1536.
+func VerifyVectorPolicy(ctx context.Context, container *azcosmos.ContainerClient, spec VectorPolicySpec) error {
+	if err := ValidateFieldName(spec.EmbeddedField); err != nil {
+		return err
+	}
+
+	settings, err := readVectorSettings(ctx, container)
+	if err != nil {
+		return err
+	}
+
+	path := "/" + spec.EmbeddedField
+	var differences []string
+	found := false
+
+	for _, e := range settings.VectorEmbeddingPolicy.VectorEmbeddings {
+		if e.Path != path {
+			continue
+		}
+		found = true
+		if e.Dimensions != spec.Dimensions {
+			differences = append(differences, fmt.Sprintf("dimensions: container has %d, configured %d", e.Dimensions, spec.Dimensions))
+		}
+		if !strings.EqualFold(e.DistanceFunction, spec.DistanceFunction) {
+			differences = append(differences, fmt.Sprintf("distance function: container has %s, configured %s", e.DistanceFunction, spec.DistanceFunction))
+		}
+	}
+
+	for _, idx := range settings.IndexingPolicy.VectorIndexes {
+		if idx.Path != path {
+			continue
+		}
+		found = true
+		if spec.IndexType != "" && !strings.EqualFold(idx.Type, spec.IndexType) {
+			differences = append(differences, fmt.Sprintf("index type: container has %s, configured %s", idx.Type, spec.IndexType))
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s on container %q", ErrNoVectorPolicy, path, container.ID())
+	}
+	if len(differences) > 0 {
+		return &VectorPolicyDriftError{Container: container.ID(), Differences: differences}
+	}
+	return nil
+}
+
+// policyDimensions caches the dimensions declared for each container's vector
+// fields, keyed by policyKey, so PolicyDimensions reads a container
+// definition once per container client. Zero means the field has no policy.
+var policyDimensions sync.Map
+
+// policyKey identifies a vector field of one container. The container client
+// is bound to one account and database, so containers of the same name in
+// other databases get their own entries; ContainerClient exposes no database
+// ID to key on instead.
+type policyKey struct {
+	container *azcosmos.ContainerClient
+	path      string
+}
+
+// CheckDimensions returns a *DimensionMismatchError when a vector of length
+// dims does not fit the container's vector policy for embeddedField. Fields
+// without a vector policy are not checked. The policy is read on the first
+// call for a container client and field and cached afterwards.
+func CheckDimensions(ctx context.Context, container *azcosmos.ContainerClient, embeddedField string, dims int) error {
+	want, err := PolicyDimensions(ctx, container, embeddedField)
+	if err != nil {
+		return err
+	}
+	if want != 0 && dims != want {
+		return &DimensionMismatchError{Field: embeddedField, Expected: want, Actual: dims}
+	}
+	return nil
+}
+
+// PolicyDimensions returns the dimensions the container's vector policy
+// declares for embeddedField, or 0 when the field has no vector policy. The
+// policy is read on the first call for a container client and field and
+// cached afterwards.
+func PolicyDimensions(ctx context.Context, container *azcosmos.ContainerClient, embeddedField string) (int, error) {
+	path := "/" + embeddedField
+	key := policyKey{container: container, path: path}
+
+	expected, ok := policyDimensions.Load(key)
+	if !ok {
+		settings, err := readVectorSettings(ctx, container)
+		if err != nil {
+			return 0, err
+		}
+		var declared int
+		for _, e := range settings.VectorEmbeddingPolicy.VectorEmbeddings {
+			if e.Path == path {
+				declared = e.Dimensions
+			}
+		}
+		expected, _ = policyDimensions.LoadOrStore(key, declared)
+	}
+	return expected.(int), nil
+}
+
+// readVectorSettings reads the container definition and decodes its vector
+// embedding policy and vector indexes.
+func readVectorSettings(ctx context.Context, container *azcosmos.ContainerClient) (*containerVectorSettings, error) {
+	resp, err := container.Read(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container %q: %w", container.ID(), ClassifyError(err))
+	}
+
+	body, err := runtime.Payload(resp.RawResponse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container %q definition: %w", container.ID(), err)
+	}
+
+	var settings containerVectorSettings
+	if err := json.Unmarshal(body, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse container %q definition: %w", container.ID(), err)
+	}
+	return &settings, nil
+}
@@ -1,146 +1,435 @@
-package query
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"regexp"
-
-	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
-	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
-)
-
-// QueryResult represents a single vector-search result row.
-type QueryResult struct {
-	HotelName       string  `json:"HotelName"`
-	Description     string  `json:"Description"`
-	Rating          float64 `json:"Rating"`
-	SimilarityScore float64 `json:"SimilarityScore"`
-}
-
-// NOTE: The Go azcosmos SDK has limited cross-partition query support.
-// TOP and ORDER BY clauses are not supported in cross-partition queries.
-// See: https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos#ContainerClient.NewQueryItemsPager
-// To enable all query patterns (including VectorDistance with TOP/ORDER BY),
-// this sample uses a single partition key value so all documents reside
-// in the same logical partition. This restriction is temporary and will be
-// revisited when the Go SDK adds full cross-partition query support.
-const partitionKeyValue = "hotels"
-
-// validIdentifier matches safe SQL identifiers (letters, digits, underscores).
-var validIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
-
-// ValidateFieldName ensures a field name is a safe SQL identifier to prevent
-// injection when the name is interpolated into a query string.
-func ValidateFieldName(fieldName string) error {
-	if !validIdentifier.MatchString(fieldName) {
-		return fmt.Errorf(
-			"invalid field name: %q — must start with a letter or underscore and contain only letters, numbers, and underscores",
-			fieldName,
-		)
-	}
-	return nil
-}
-
-// GenerateEmbedding calls Azure OpenAI to produce an embedding vector for the
-// given text, returning a []float32 suitable for VectorDistance queries.
-func GenerateEmbedding(ctx context.Context, client *azopenai.Client, text, deployment string) ([]float32, error) {
-	resp, err := client.GetEmbeddings(ctx, azopenai.EmbeddingsOptions{
-		Input:          []string{text},
-		DeploymentName: &deployment,
-	}, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate embedding: %w", err)
-	}
-
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding data returned")
-	}
-
-	return resp.Data[0].Embedding, nil
-}
-
-// ExecuteVectorSearch builds and runs a VectorDistance SQL query against the
-// Cosmos DB container. Returns the result rows and the total request charge.
-func ExecuteVectorSearch(
-	ctx context.Context,
-	container *azcosmos.ContainerClient,
-	embedding []float32,
-	embeddedField string,
-) ([]QueryResult, float64, error) {
-	if err := ValidateFieldName(embeddedField); err != nil {
-		return nil, 0, err
-	}
-
-	// Build the SQL query with VectorDistance.
-	// TOP + ORDER BY works here because all docs share a single partition key.
-	queryText := fmt.Sprintf(
-		"SELECT TOP 5 c.HotelName, c.Description, c.Rating, "+
-			"VectorDistance(c.%s, @embedding) AS SimilarityScore "+
-			"FROM c "+
-			"ORDER BY VectorDistance(c.%s, @embedding)",
-		embeddedField, embeddedField,
-	)
-
-	// Serialize the embedding to a JSON array for the parameter value.
-	embeddingJSON, err := json.Marshal(embedding)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to marshal embedding: %w", err)
-	}
-
-	params := azcosmos.QueryOptions{
-		QueryParameters: []azcosmos.QueryParameter{
-			{Name: "@embedding", Value: json.RawMessage(embeddingJSON)},
-		},
-	}
-
-	fmt.Println("\n--- Executing Vector Search Query ---")
-	fmt.Println("Query:", queryText)
-	fmt.Printf("Parameters: @embedding (vector with %d dimensions)\n", len(embedding))
-	fmt.Println("--------------------------------------")
-
-	pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
-	pager := container.NewQueryItemsPager(queryText, pk, &params)
-
-	var results []QueryResult
-	var totalCharge float64
-
-	for pager.More() {
-		resp, err := pager.NextPage(ctx)
-		if err != nil {
-			return nil, totalCharge, fmt.Errorf("query failed: %w", err)
-		}
-
-		totalCharge += float64(resp.RequestCharge)
-
-		if resp.ActivityID != "" {
-			fmt.Println("Query activity ID:", resp.ActivityID)
-		}
-
-		for _, raw := range resp.Items {
-			var r QueryResult
-			if err := json.Unmarshal(raw, &r); err != nil {
-				fmt.Printf("Warning: could not unmarshal result: %v\n", err)
-				continue
-			}
-			results = append(results, r)
-		}
-	}
-
-	return results, totalCharge, nil
-}
-
-// PrintSearchResults outputs the results to stdout in a human-readable format.
-func PrintSearchResults(results []QueryResult, requestCharge float64) {
-	fmt.Println("\n--- Search Results ---")
-	if len(results) == 0 {
-		fmt.Println("No results found.")
-		return
-	}
-
-	for i, r := range results {
-		fmt.Printf("%d. %s, Score: %.4f\n", i+1, r.HotelName, r.SimilarityScore)
-	}
-
-	fmt.Printf("\nVector Search Request Charge: %.2f RUs\n\n", requestCharge)
-}
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/cosmos-db-vector-samples/nosql-vector-search-go/internal/embedcache"
+)
+
+// QueryResult represents a single vector-search result row.
+type QueryResult struct {
+	ID              string  `json:"id"`
+	HotelName       string  `json:"HotelName"`
+	Description     string  `json:"Description"`
+	Rating          float64 `json:"Rating"`
+	SimilarityScore float64 `json:"SimilarityScore"`
+
+	// Vector is the document's embedding. It is only populated when the
+	// search uses WithVectors.
+	Vector []float32 `json:"Vector,omitempty"`
+
+	// DistanceFunction is the metric that produced SimilarityScore. It is not
+	// part of the query projection; ExecuteVectorSearch sets it on every row.
+	DistanceFunction string `json:"-"`
+
+	// NormalizedScore is SimilarityScore mapped onto a 0-1 similarity scale
+	// by NormalizeScore, so scores from different distance functions can be
+	// compared. ExecuteVectorSearch sets it on every row.
+	NormalizedScore float64 `json:"-"`
+
+	// Source is the container the result came from. It is only set by
+	// ExecuteContainersSearch.
+	Source string `json:"-"`
+
+	// ParentID is the hotel a chunk document belongs to; it is empty for
+	// hotel documents. WithCollapseChunks folds chunks into their parent.
+	ParentID string `json:"ParentId,omitempty"`
+	// ChunkText is the passage of a long description that matched, for
+	// results that came from a chunk document.
+	ChunkText string `json:"ChunkText,omitempty"`
+}
+
+// Distance functions supported by the VectorDistance system function.
+const (
+	DistanceCosine     = "cosine"
+	DistanceDotProduct = "dotproduct"
+	DistanceEuclidean  = "euclidean"
+)
+
+var distanceFunctions = []string{DistanceCosine, DistanceDotProduct, DistanceEuclidean}
+
+// NOTE: The Go azcosmos SDK has limited cross-partition query support.
+// TOP and ORDER BY clauses are not supported in cross-partition queries.
+// See: https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos#ContainerClient.NewQueryItemsPager
+// To enable all query patterns (including VectorDistance with TOP/ORDER BY),
+// this sample uses a single partition key value so all documents reside
+// in the same logical partition. This restriction is temporary and will be
+// revisited when the Go SDK adds full cross-partition query support.
+const partitionKeyValue = "hotels"
+
+// validIdentifier matches safe SQL identifiers (letters, digits, underscores).
+var validIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateFieldName ensures a field name is a safe SQL identifier to prevent
+// injection when the name is interpolated into a query string.
+func ValidateFieldName(fieldName string) error {
+	if !validIdentifier.MatchString(fieldName) {
+		return fmt.Errorf(
+			"invalid field name: %q — must start with a letter or underscore and contain only letters, numbers, and underscores",
+			fieldName,
+		)
+	}
+	return nil
+}
+
+// ValidateDistanceFunction ensures the distance function is one that
+// VectorDistance understands. The value is interpolated into the query text,
+// so anything outside the known set is rejected.
+func ValidateDistanceFunction(distanceFunction string) error {
+	if !slices.Contains(distanceFunctions, distanceFunction) {
+		return fmt.Errorf("unknown distance function %q; must be one of: %s", distanceFunction, strings.Join(distanceFunctions, ", "))
+	}
+	return nil
+}
+
+// HigherIsBetter reports whether a larger score means a closer match for the
+// given distance function. Cosine and dot product return similarities, while
+// euclidean returns a distance where smaller is closer.
+func HigherIsBetter(distanceFunction string) bool {
+	return distanceFunction != DistanceEuclidean
+}
+
+// HigherIsBetter reports whether a larger SimilarityScore means a closer
+// match for the distance function that produced r.
+func (r *QueryResult) HigherIsBetter() bool {
+	return HigherIsBetter(r.DistanceFunction)
+}
+
+// NormalizeScore maps a VectorDistance score onto a similarity between 0
+// (opposite) and 1 (identical), so results are comparable whatever distance
+// function produced them. The mapping assumes unit-length embeddings, which
+// is what Azure OpenAI returns: cosine and dot product then range over
+// [-1, 1] and euclidean distance over [0, 2], and all three map to the same
+// value for the same pair of vectors. Out-of-range scores are clamped.
+func NormalizeScore(score float64, distanceFunction string) float64 {
+	var similarity float64
+	switch distanceFunction {
+	case DistanceEuclidean:
+		// For unit vectors, cosine similarity = 1 - distance²/2.
+		similarity = 1 - score*score/4
+	default:
+		similarity = (score + 1) / 2
+	}
+	return min(max(similarity, 0), 1)
+}
+
+// GenerateEmbedding calls Azure OpenAI to produce an embedding vector for the
+// given text, returning a []float32 suitable for VectorDistance queries.
+func GenerateEmbedding(ctx context.Context, client *azopenai.Client, text, deployment string, opts ...EmbeddingOption) ([]float32, error) {
+	resp, err := client.GetEmbeddings(ctx, newEmbeddingsOptions([]string{text}, deployment, opts), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embedding: %w", ClassifyError(err))
+	}
+	recordEmbeddingUsage(ctx, resp.Usage)
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no embedding data returned")
+	}
+
+	return resp.Data[0].Embedding, nil
+}
+
+// GenerateEmbeddingCached is GenerateEmbedding with cache in front of it: a
+// text already embedded by the deployment, at the same dimensions, is
+// returned from the cache, and a new embedding is stored in it. A nil cache
+// calls GenerateEmbedding directly.
+func GenerateEmbeddingCached(ctx context.Context, client *azopenai.Client, cache embedcache.Cache, text, deployment string, opts ...EmbeddingOption) ([]float32, error) {
+	if cache == nil {
+		return GenerateEmbedding(ctx, client, text, deployment, opts...)
+	}
+	// Vectors shortened with WithDimensions differ from the full ones, so
+	// they are cached apart.
+	key := deployment
+	if req := newEmbeddingsOptions(nil, deployment, opts); req.Dimensions != nil {
+		key = fmt.Sprintf("%s@%d", deployment, *req.Dimensions)
+	}
+	if vector, ok := cache.Get(key, text); ok {
+		return vector, nil
+	}
+
+	vector, err := GenerateEmbedding(ctx, client, text, deployment, opts...)
+	if err != nil {
+		return nil, err
+	}
+	cache.Put(key, text, vector)
+	return vector, nil
+}
+
+// ExecuteVectorSearch builds and runs a VectorDistance SQL query against the
+// Cosmos DB container. Returns the result rows and the total request charge.
+func ExecuteVectorSearch(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	opts ...SearchOption,
+) ([]QueryResult, float64, error) {
+	options, err := newSearchOptions(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx, cancel := options.withTimeout(ctx)
+	defer cancel()
+	// A context that is already done fails here, before any request.
+	if err := ctx.Err(); err != nil {
+		return nil, 0, ClassifyError(err)
+	}
+
+	if err := ValidateFieldName(embeddedField); err != nil {
+		return nil, 0, err
+	}
+	if err := CheckDimensions(ctx, container, embeddedField, len(embedding)); err != nil {
+		return nil, 0, err
+	}
+	for _, v := range options.NegativeExamples {
+		if len(v) != len(embedding) {
+			return nil, 0, &DimensionMismatchError{Field: "negative example", Expected: len(embedding), Actual: len(v)}
+		}
+	}
+	if options.Dedupe {
+		return executeDedupedSearch(ctx, container, embedding, embeddedField, distanceFunction, options, opts)
+	}
+	if options.CollapseChunks {
+		return executeCollapsedSearch(ctx, container, embedding, embeddedField, distanceFunction, options, opts)
+	}
+
+	queryText, params, err := buildVectorQuery(embedding, embeddedField, distanceFunction, options)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fmt.Println("\n--- Executing Vector Search Query ---")
+	fmt.Println("Query:", queryText)
+	fmt.Printf("Parameters: @embedding (vector with %d dimensions)\n", len(embedding))
+	for _, p := range options.filterParameters() {
+		fmt.Printf("            %s = %v\n", p.Name, p.Value)
+	}
+	fmt.Println("--------------------------------------")
+
+	rows, totalCharge, err := runQuery(ctx, container, queryText, params)
+	if err != nil {
+		return nil, totalCharge, err
+	}
+
+	results, dropped := scoreRows(rows, distanceFunction, options)
+	if dropped > 0 {
+		slog.InfoContext(ctx, "dropped results below minimum score",
+			slog.Int("dropped", dropped),
+			slog.Float64("minScore", *options.MinScore),
+		)
+	}
+
+	if len(options.NegativeExamples) > 0 {
+		results = FilterNegativeExamples(results, options.NegativeExamples, options.NegativeThreshold)
+		if !options.IncludeVectors {
+			for i := range results {
+				results[i].Vector = nil
+			}
+		}
+	}
+
+	return page(options, results), totalCharge, nil
+}
+
+// scoreRows sets the distance function and normalized score of the rows a
+// vector query returned and drops those that miss the MinScore threshold,
+// returning the rest and the number dropped. The threshold is applied to the
+// rows already read, so it never costs another request.
+func scoreRows(rows []QueryResult, distanceFunction string, options *SearchOptions) ([]QueryResult, int) {
+	results := make([]QueryResult, 0, len(rows))
+	dropped := 0
+	for _, r := range rows {
+		r.DistanceFunction = distanceFunction
+		r.NormalizedScore = NormalizeScore(r.SimilarityScore, distanceFunction)
+		if !options.meetsMinScore(r.SimilarityScore, distanceFunction) {
+			dropped++
+			continue
+		}
+		results = append(results, r)
+	}
+	return results, dropped
+}
+
+// buildVectorQuery returns the VectorDistance query text and its parameters
+// for the given search options.
+func buildVectorQuery(
+	embedding []float32,
+	embeddedField string,
+	distanceFunction string,
+	options *SearchOptions,
+) (string, []azcosmos.QueryParameter, error) {
+	if err := ValidateFieldName(embeddedField); err != nil {
+		return "", nil, err
+	}
+	if err := ValidateDistanceFunction(distanceFunction); err != nil {
+		return "", nil, err
+	}
+
+	// Build the SQL query with VectorDistance. The distance function is passed
+	// explicitly so the query does not depend on the container's default.
+	// TOP + ORDER BY works here because all docs share a single partition key.
+	vectorDistance := fmt.Sprintf(
+		"VectorDistance(c.%s, @embedding, %t, %s)",
+		embeddedField, options.BruteForce, options.vectorDistanceOptions(distanceFunction),
+	)
+	vectorColumn := ""
+	if options.IncludeVectors || len(options.NegativeExamples) > 0 {
+		vectorColumn = fmt.Sprintf("c.%s AS Vector, ", embeddedField)
+	}
+	queryText := fmt.Sprintf(
+		"SELECT TOP %d c.id, c.HotelName, c.Description, c.Rating, c.ParentId, c.ChunkText, %s"+
+			"%s AS SimilarityScore "+
+			"FROM c "+
+			"%s"+
+			"ORDER BY %s",
+		options.fetchCount(), vectorColumn, vectorDistance, options.whereClause(options.after.predicate(vectorDistance, distanceFunction)), vectorDistance,
+	)
+
+	// Serialize the embedding to a JSON array for the parameter value.
+	embeddingJSON, err := json.Marshal(embedding)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal embedding: %w", err)
+	}
+
+	params := append([]azcosmos.QueryParameter{
+		{Name: "@embedding", Value: json.RawMessage(embeddingJSON)},
+	}, options.filterParameters()...)
+	params = append(params, options.after.parameters()...)
+
+	return queryText, params, nil
+}
+
+// Recall returns the fraction of the exact (brute-force) results that also
+// appear in the approximate (indexed) results, matched by document id. A value
+// of 1 means the index found every true nearest neighbor.
+func Recall(exact, approx []QueryResult) float64 {
+	if len(exact) == 0 {
+		return 0
+	}
+
+	found := make(map[string]bool, len(approx))
+	for _, r := range approx {
+		found[r.ID] = true
+	}
+
+	hits := 0
+	for _, r := range exact {
+		if found[r.ID] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(exact))
+}
+
+// runQuery executes a query in the sample's partition, reading every page.
+// Returns the decoded rows and the total request charge.
+func runQuery(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	queryText string,
+	params []azcosmos.QueryParameter,
+) ([]QueryResult, float64, error) {
+	var results []QueryResult
+	var totalCharge float64
+
+	for r, err := range queryRows(ctx, container, queryText, params, &totalCharge) {
+		if err != nil {
+			return nil, totalCharge, err
+		}
+		results = append(results, r)
+	}
+
+	return results, totalCharge, nil
+}
+
+// queryRows executes a query in the sample's partition and yields its rows as
+// they arrive, fetching the next page only when the previous one has been
+// consumed. The request charge of each page is added to *charge. A failed
+// page yields the error and ends the sequence.
+func queryRows(
+	ctx context.Context,
+	container *azcosmos.ContainerClient,
+	queryText string,
+	params []azcosmos.QueryParameter,
+	charge *float64,
+) iter.Seq2[QueryResult, error] {
+	return func(yield func(QueryResult, error) bool) {
+		pk := azcosmos.NewPartitionKey().AppendString(partitionKeyValue)
+		pager := container.NewQueryItemsPager(queryText, pk, &azcosmos.QueryOptions{QueryParameters: params})
+
+		for pager.More() {
+			resp, err := pager.NextPage(ctx)
+			if err != nil {
+				yield(QueryResult{}, fmt.Errorf("query failed: %w", ClassifyError(err)))
+				return
+			}
+
+			*charge += float64(resp.RequestCharge)
+
+			slog.DebugContext(ctx, "query page",
+				slog.String("activityID", resp.ActivityID),
+				slog.Int("items", len(resp.Items)),
+				slog.Float64("requestCharge", float64(resp.RequestCharge)),
+			)
+
+			for _, raw := range resp.Items {
+				var r QueryResult
+				if err := json.Unmarshal(raw, &r); err != nil {
+					slog.WarnContext(ctx, "could not unmarshal result", slog.Any("error", err))
+					continue
+				}
+				if !yield(r, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// PrintSearchResults outputs the results to stdout in a human-readable format.
+func PrintSearchResults(results []QueryResult, requestCharge float64) {
+	fmt.Println("\n--- Search Results ---")
+	if len(results) == 0 {
+		fmt.Println("No good matches found.")
+		return
+	}
+
+	// Full-text results are ranked by relevance and carry no vector score.
+	if results[0].DistanceFunction == "" {
+		for i, r := range results {
+			fmt.Printf("%d. %s\n", i+1, r.HotelName)
+		}
+		fmt.Printf("\nSearch Request Charge: %.2f RUs\n\n", requestCharge)
+		return
+	}
+
+	if results[0].HigherIsBetter() {
+		fmt.Printf("Distance function: %s (higher raw score = more similar)\n", results[0].DistanceFunction)
+	} else {
+		fmt.Printf("Distance function: %s (lower raw score = more similar)\n", results[0].DistanceFunction)
+	}
+
+	for i, r := range results {
+		name := r.HotelName
+		if r.Source != "" {
+			name += " [" + r.Source + "]"
+		}
+		fmt.Printf("%d. %s, Score: %.4f (raw %.4f)\n", i+1, name, r.NormalizedScore, r.SimilarityScore)
+		if r.ChunkText != "" {
+			fmt.Printf("   Matched passage: %s\n", r.ChunkText)
+		}
+	}
+
+	fmt.Printf("\nVector Search Request Charge: %.2f RUs\n\n", requestCharge)
+}
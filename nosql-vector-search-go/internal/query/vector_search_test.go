@@ -0,0 +1,281 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// paramNames returns the names of params, in order.
+func paramNames(params []azcosmos.QueryParameter) []string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func TestBuildVectorQueryFilter(t *testing.T) {
+	embedding := []float32{0.1, 0.2, 0.3}
+
+	tests := []struct {
+		name       string
+		opts       []SearchOption
+		wantWhere  string
+		wantParams []string
+	}{
+		{
+			name:       "no filter",
+			wantParams: []string{"@embedding"},
+		},
+		{
+			name: "filter with parameters",
+			opts: []SearchOption{WithFilter("c.Address.City = @city AND c.Rating >= @minRating",
+				azcosmos.QueryParameter{Name: "@city", Value: "Seattle"},
+				azcosmos.QueryParameter{Name: "@minRating", Value: 4})},
+			wantWhere:  "WHERE (c.Address.City = @city AND c.Rating >= @minRating) ",
+			wantParams: []string{"@embedding", "@city", "@minRating"},
+		},
+		{
+			name:       "empty filter",
+			opts:       []SearchOption{WithFilter("")},
+			wantParams: []string{"@embedding"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := newSearchOptions(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			queryText, params, err := buildVectorQuery(embedding, "DescriptionVector", DistanceCosine, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantWhere == "" {
+				if strings.Contains(queryText, "WHERE") {
+					t.Errorf("query has a WHERE clause without a filter: %s", queryText)
+				}
+			} else if !strings.Contains(queryText, "FROM c "+tt.wantWhere+"ORDER BY") {
+				t.Errorf("query does not filter before ranking with %q: %s", tt.wantWhere, queryText)
+			}
+			if got := strings.Join(paramNames(params), ","); got != strings.Join(tt.wantParams, ",") {
+				t.Errorf("parameters = %s, want %s", got, strings.Join(tt.wantParams, ","))
+			}
+		})
+	}
+}
+
+func TestBuildVectorQueryUsesEmbeddedField(t *testing.T) {
+	for _, field := range []string{"embedding", "vector", "content_vector", "DescriptionVector3"} {
+		t.Run(field, func(t *testing.T) {
+			options, err := newSearchOptions([]SearchOption{WithVectors()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			queryText, _, err := buildVectorQuery([]float32{0.1}, field, DistanceCosine, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"VectorDistance(c." + field + ", @embedding,", "c." + field + " AS Vector,"} {
+				if !strings.Contains(queryText, want) {
+					t.Errorf("query does not contain %q: %s", want, queryText)
+				}
+			}
+			if field != "DescriptionVector3" && strings.Contains(queryText, "DescriptionVector") {
+				t.Errorf("query still names the default field: %s", queryText)
+			}
+		})
+	}
+}
+
+func TestBuildVectorQueryDistanceFunction(t *testing.T) {
+	options, err := newSearchOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		distanceFunction string
+		wantErr          bool
+	}{
+		{DistanceCosine, false},
+		{DistanceDotProduct, false},
+		{DistanceEuclidean, false},
+		{"manhattan", true},
+		{"Cosine", true},
+		{"cosine'}) OR (1=1", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.distanceFunction, func(t *testing.T) {
+			queryText, _, err := buildVectorQuery([]float32{0.1}, "DescriptionVector", tc.distanceFunction, options)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("buildVectorQuery accepted distance function %q: %s", tc.distanceFunction, queryText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "'distanceFunction': '" + tc.distanceFunction + "'"; !strings.Contains(queryText, want) {
+				t.Errorf("query does not contain %q: %s", want, queryText)
+			}
+		})
+	}
+}
+
+func TestValidateFieldName(t *testing.T) {
+	for _, name := range []string{"embedding", "content_vector", "_v", "DescriptionVector3"} {
+		if err := ValidateFieldName(name); err != nil {
+			t.Errorf("ValidateFieldName(%q) = %v, want nil", name, err)
+		}
+	}
+	// Each of these would change the query if interpolated into it.
+	for _, name := range []string{"", "content.vector", "3vector", "vector ", "vector, c.id", "vector) OR (1=1", "c[\"vector\"]"} {
+		if err := ValidateFieldName(name); err == nil {
+			t.Errorf("ValidateFieldName(%q) = nil, want an error", name)
+		}
+		options, _ := newSearchOptions(nil)
+		if _, _, err := buildVectorQuery([]float32{0.1}, name, DistanceCosine, options); err == nil {
+			t.Errorf("buildVectorQuery accepted field %q", name)
+		}
+	}
+}
+
+func TestWithFilterRejectsReservedParameters(t *testing.T) {
+	_, err := newSearchOptions([]SearchOption{
+		WithFilter("c.x = @embedding", azcosmos.QueryParameter{Name: "@embedding", Value: 1}),
+	})
+	if err == nil {
+		t.Fatal("newSearchOptions accepted a filter parameter named @embedding")
+	}
+}
+
+func TestScoreRowsMinScore(t *testing.T) {
+	rows := []QueryResult{
+		{ID: "1", SimilarityScore: 0.9},
+		{ID: "2", SimilarityScore: 0.7},
+		{ID: "3", SimilarityScore: 0.5},
+	}
+
+	tests := []struct {
+		name             string
+		distanceFunction string
+		minScore         float64
+		wantIDs          string
+	}{
+		{"cosine keeps scores at or above", DistanceCosine, 0.7, "1,2"},
+		{"cosine drops everything", DistanceCosine, 0.95, ""},
+		{"euclidean keeps distances at or below", DistanceEuclidean, 0.7, "2,3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := newSearchOptions([]SearchOption{WithMinScore(tt.minScore)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, dropped := scoreRows(rows, tt.distanceFunction, options)
+
+			ids := make([]string, len(results))
+			for i, r := range results {
+				ids[i] = r.ID
+			}
+			if got := strings.Join(ids, ","); got != tt.wantIDs {
+				t.Errorf("kept %q, want %q", got, tt.wantIDs)
+			}
+			if dropped != len(rows)-len(results) {
+				t.Errorf("dropped = %d, want %d", dropped, len(rows)-len(results))
+			}
+		})
+	}
+}
+
+// BenchmarkMinScoreCutoff measures the minimum score cutoff over a large
+// result set. scoreRows works on rows that were already read and takes no
+// container, so the cutoff cannot issue another request.
+func BenchmarkMinScoreCutoff(b *testing.B) {
+	rows := make([]QueryResult, 1000)
+	for i := range rows {
+		rows[i] = QueryResult{ID: fmt.Sprint(i), SimilarityScore: 1 - float64(i)/float64(len(rows))}
+	}
+	options, err := newSearchOptions([]SearchOption{WithMinScore(0.5)})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		scoreRows(rows, DistanceCosine, options)
+	}
+}
+
+func TestNormalizeScore(t *testing.T) {
+	tests := []struct {
+		distanceFunction string
+		score            float64
+		want             float64
+	}{
+		{DistanceCosine, 1, 1},
+		{DistanceCosine, 0, 0.5},
+		{DistanceCosine, -1, 0},
+		{DistanceCosine, 1.5, 1},
+		{DistanceCosine, -1.5, 0},
+		{DistanceDotProduct, 1, 1},
+		{DistanceDotProduct, 0, 0.5},
+		{DistanceDotProduct, -1, 0},
+		{DistanceDotProduct, 3, 1},
+		{DistanceEuclidean, 0, 1},
+		{DistanceEuclidean, math.Sqrt2, 0.5},
+		{DistanceEuclidean, 2, 0},
+		{DistanceEuclidean, 3, 0},
+		{"", 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%g", tt.distanceFunction, tt.score), func(t *testing.T) {
+			if got := NormalizeScore(tt.score, tt.distanceFunction); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("NormalizeScore(%g, %q) = %g, want %g", tt.score, tt.distanceFunction, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNormalizeScoreAgreesAcrossFunctions checks that the three distance
+// functions give the same normalized score for the same pair of unit vectors.
+func TestNormalizeScoreAgreesAcrossFunctions(t *testing.T) {
+	a := []float64{1, 0}
+	for _, b := range [][]float64{{1, 0}, {0.6, 0.8}, {0, 1}, {-0.8, 0.6}, {-1, 0}} {
+		dot := a[0]*b[0] + a[1]*b[1]
+		dist := math.Hypot(a[0]-b[0], a[1]-b[1])
+
+		cosine := NormalizeScore(dot, DistanceCosine)
+		dotProduct := NormalizeScore(dot, DistanceDotProduct)
+		euclidean := NormalizeScore(dist, DistanceEuclidean)
+		if math.Abs(cosine-dotProduct) > 1e-9 || math.Abs(cosine-euclidean) > 1e-9 {
+			t.Errorf("b = %v: cosine %g, dot product %g, euclidean %g differ", b, cosine, dotProduct, euclidean)
+		}
+	}
+}
+
+func TestExecuteVectorSearchExpiredContext(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	// A nil container panics if the search sends any request.
+	_, _, err := ExecuteVectorSearch(ctx, nil, []float32{1, 0}, "DescriptionVector", DistanceCosine, WithTimeout(time.Minute))
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("error = %v, want ErrTimeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+}